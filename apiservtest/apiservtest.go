@@ -0,0 +1,111 @@
+// Package apiservtest provides helpers to test apiserv handlers in-process, without a real socket.
+package apiservtest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/missionMeteora/apiserv"
+)
+
+// New returns a new Client that serves requests using h, usually an *apiserv.Server.
+func New(h http.Handler) *Client {
+	return &Client{
+		h:      h,
+		Header: http.Header{},
+	}
+}
+
+// Client serves requests in-process using the wrapped handler's ServeHTTP.
+type Client struct {
+	h http.Handler
+
+	// Header is added to every request.
+	Header http.Header
+}
+
+// WithHeader returns a copy of the client with the header k set to v.
+func (c *Client) WithHeader(k, v string) *Client {
+	cp := &Client{
+		h:      c.h,
+		Header: c.Header.Clone(),
+	}
+	cp.Header.Set(k, v)
+	return cp
+}
+
+// Do serves req and returns the recorded response.
+func (c *Client) Do(req *http.Request) *http.Response {
+	for k, vs := range c.Header {
+		if _, ok := req.Header[k]; !ok {
+			req.Header[k] = vs
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	c.h.ServeHTTP(rec, req)
+	return rec.Result()
+}
+
+// DoJSON serves a request with body encoded as json and decodes the standard apiserv envelope from the response.
+// body can be nil, []byte, string or io.Reader to be sent as-is, anything else gets encoded with apiserv.JSONMarshal.
+// Unlike apiserv.ReadJSONResponse, it doesn't return an error for non-success responses.
+func (c *Client) DoJSON(method, path string, body interface{}) (*apiserv.JSONResponse, *http.Response, error) {
+	var rd io.Reader
+	switch v := body.(type) {
+	case nil:
+	case []byte:
+		rd = bytes.NewReader(v)
+	case string:
+		rd = strings.NewReader(v)
+	case io.Reader:
+		rd = v
+	default:
+		b, err := apiserv.JSONMarshal(v)
+		if err != nil {
+			return nil, nil, err
+		}
+		rd = bytes.NewReader(b)
+	}
+
+	req := httptest.NewRequest(method, path, rd)
+	if rd != nil {
+		req.Header.Set("Content-Type", apiserv.MimeJSON)
+	}
+
+	resp := c.Do(req)
+	b, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, resp, err
+	}
+
+	var r apiserv.JSONResponse
+	if len(b) > 0 {
+		err = apiserv.JSONUnmarshal(b, &r)
+	}
+
+	return &r, resp, err
+}
+
+// Path replaces the params in a route pattern with the passed key, value pairs, for example:
+//	Path("/users/:id/*fp", "id", "42", "fp", "a/b") returns "/users/42/a/b"
+func Path(pattern string, kvs ...string) string {
+	parts := strings.Split(pattern, "/")
+	for i, p := range parts {
+		if p == "" || (p[0] != ':' && p[0] != '*') {
+			continue
+		}
+
+		for j := 0; j+1 < len(kvs); j += 2 {
+			if kvs[j] == p[1:] {
+				parts[i] = kvs[j+1]
+				break
+			}
+		}
+	}
+	return strings.Join(parts, "/")
+}
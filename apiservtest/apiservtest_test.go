@@ -0,0 +1,39 @@
+package apiservtest_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/missionMeteora/apiserv"
+	"github.com/missionMeteora/apiserv/apiservtest"
+)
+
+func TestDoJSON(t *testing.T) {
+	srv := apiserv.New(apiserv.SetErrLogger(nil))
+	srv.POST("/users/:id", func(ctx *apiserv.Context) apiserv.Response {
+		var req apiserv.M
+		if r := ctx.MustBindJSON(&req); r != nil {
+			return r
+		}
+		return apiserv.NewJSONResponse(ctx.Param("id") + ":" + req["name"].(string) + ":" + ctx.ReqHeader().Get("X-Test"))
+	})
+
+	c := apiservtest.New(srv).WithHeader("X-Test", "1")
+
+	r, resp, err := c.DoJSON(http.MethodPost, apiservtest.Path("/users/:id", "id", "42"), apiserv.M{"name": "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK || r.Data != "42:x:1" {
+		t.Fatalf("unexpected response (%d): %+v", resp.StatusCode, r)
+	}
+
+	if r, resp, err = c.DoJSON(http.MethodPost, "/users/1", "{"); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusBadRequest || r.Success || len(r.Errors) != 1 {
+		t.Fatalf("unexpected response (%d): %+v", resp.StatusCode, r)
+	}
+}
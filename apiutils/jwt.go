@@ -0,0 +1,62 @@
+package apiutils
+
+import (
+	"errors"
+	"net/http"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	jwtReq "github.com/golang-jwt/jwt/v4/request"
+	"github.com/missionMeteora/apiserv"
+)
+
+// ErrNoKeyFunc is returned by JWTAuth if JWTOptions.KeyFunc is not set.
+var ErrNoKeyFunc = errors.New("missing JWTOptions.KeyFunc")
+
+// JWTOptions controls how JWTAuth parses and verifies tokens.
+type JWTOptions struct {
+	// KeyFunc returns the key used to verify the token's signature.
+	KeyFunc jwt.Keyfunc
+
+	// SigningMethods is the list of accepted signing algorithms (ex: "HS256", "RS256"),
+	// if empty, any method supported by jwt is accepted.
+	SigningMethods []string
+
+	// ContextKey is an optional extra key to store the claims under,
+	// the claims are always accessible using ctx.Claims().
+	ContextKey string
+}
+
+// JWTAuth returns a middleware that verifies the `Authorization: Bearer` token of each request,
+// including its signature and expiry, and stores its claims in the context.
+// It returns a 401 error response if the token is missing or invalid.
+func JWTAuth(opts JWTOptions) apiserv.Handler {
+	parser := &jwt.Parser{
+		ValidMethods:  opts.SigningMethods,
+		UseJSONNumber: true,
+	}
+
+	return func(ctx *apiserv.Context) apiserv.Response {
+		if opts.KeyFunc == nil {
+			return apiserv.NewJSONErrorResponse(http.StatusInternalServerError, ErrNoKeyFunc)
+		}
+
+		if ctx.ReqHeader().Get("Authorization") == "" {
+			return apiserv.NewJSONErrorResponse(http.StatusUnauthorized, ErrNoAuthHeader)
+		}
+
+		tok, err := jwtReq.ParseFromRequest(ctx.Req, jwtReq.AuthorizationHeaderExtractor, opts.KeyFunc,
+			jwtReq.WithClaims(jwt.MapClaims{}), jwtReq.WithParser(parser))
+		if err != nil {
+			return apiserv.NewJSONErrorResponse(http.StatusUnauthorized, err)
+		}
+
+		claims := map[string]interface{}(tok.Claims.(jwt.MapClaims))
+		ctx.Set(apiserv.ClaimsContextKey, claims)
+
+		if opts.ContextKey != "" {
+			ctx.Set(opts.ContextKey, claims)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,89 @@
+package apiutils
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/missionMeteora/apiserv"
+	"github.com/missionMeteora/apiserv/apiservtest"
+)
+
+var jwtTestKey = []byte("test-secret")
+
+func signToken(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+	s, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestJWTAuth(t *testing.T) {
+	srv := apiserv.New(apiserv.SetErrLogger(nil))
+	srv.Use(JWTAuth(JWTOptions{
+		KeyFunc:        func(*jwt.Token) (interface{}, error) { return jwtTestKey, nil },
+		SigningMethods: []string{"HS256"},
+		ContextKey:     "user",
+	}))
+	srv.GET("/me", func(ctx *apiserv.Context) apiserv.Response {
+		claims, ok := ctx.Claims()
+		if !ok {
+			return apiserv.NewJSONErrorResponse(http.StatusInternalServerError, "missing claims")
+		}
+
+		if u, _ := ctx.Get("user").(map[string]interface{}); u["sub"] != claims["sub"] {
+			return apiserv.NewJSONErrorResponse(http.StatusInternalServerError, "missing ContextKey claims")
+		}
+
+		return apiserv.NewJSONResponse(claims["sub"])
+	})
+
+	valid := jwt.MapClaims{"sub": "bob", "exp": time.Now().Add(time.Hour).Unix()}
+	expired := jwt.MapClaims{"sub": "bob", "exp": time.Now().Add(-time.Hour).Unix()}
+
+	for _, tc := range []struct {
+		name  string
+		token string
+		code  int
+	}{
+		{"valid", signToken(t, jwt.SigningMethodHS256, jwtTestKey, valid), http.StatusOK},
+		{"missing", "", http.StatusUnauthorized},
+		{"expired", signToken(t, jwt.SigningMethodHS256, jwtTestKey, expired), http.StatusUnauthorized},
+		{"wrong alg", signToken(t, jwt.SigningMethodHS384, jwtTestKey, valid), http.StatusUnauthorized},
+		{"none alg", signToken(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, valid), http.StatusUnauthorized},
+		{"bad signature", signToken(t, jwt.SigningMethodHS256, []byte("other-secret"), valid), http.StatusUnauthorized},
+		{"garbage", "not.a.token", http.StatusUnauthorized},
+	} {
+		c := apiservtest.New(srv)
+		if tc.token != "" {
+			c = c.WithHeader("Authorization", "Bearer "+tc.token)
+		}
+
+		r, _, err := c.DoJSON(http.MethodGet, "/me", nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		if r.Code != tc.code {
+			t.Fatalf("%s: expected %d, got %d (%v)", tc.name, tc.code, r.Code, r.Errors)
+		}
+
+		if tc.code == http.StatusOK && r.Data != "bob" {
+			t.Fatalf("%s: unexpected claims: %v", tc.name, r.Data)
+		}
+	}
+}
+
+func TestJWTAuthNoKeyFunc(t *testing.T) {
+	srv := apiserv.New(apiserv.SetErrLogger(nil))
+	srv.Use(JWTAuth(JWTOptions{}))
+	srv.GET("/", func(ctx *apiserv.Context) apiserv.Response { return apiserv.RespOK })
+
+	r, _, err := apiservtest.New(srv).WithHeader("Authorization", "Bearer x").DoJSON(http.MethodGet, "/", nil)
+	if err != nil || r.Code != http.StatusInternalServerError {
+		t.Fatalf("unexpected response: %v %+v", err, r)
+	}
+}
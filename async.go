@@ -0,0 +1,40 @@
+package apiserv
+
+import (
+	"context"
+	"runtime/debug"
+)
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the request id stored in the context passed to ctx.Go's func.
+func RequestIDFromContext(c context.Context) string {
+	id, _ := c.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Go runs fn in a new goroutine for fire-and-forget work that can outlive the request,
+// fn gets a context that isn't canceled when the request ends, carrying the request's id (see RequestIDFromContext).
+// Panics in fn are recovered and logged to the server's logger with the request's log prefix.
+// fn must not use ctx since it gets reused once the request is done.
+func (ctx *Context) Go(fn func(c context.Context)) {
+	c := context.Background()
+	if id := ctx.RequestID(); id != "" {
+		c = context.WithValue(c, requestIDKey{}, id)
+	}
+
+	s, prefix := ctx.s, ""
+	if s != nil {
+		prefix = ctx.logPrefix()
+	}
+
+	go func() {
+		defer func() {
+			if v := recover(); v != nil && s != nil {
+				s.Logf("%sPANIC in ctx.Go (%T): %v\n%s", prefix, v, v, debug.Stack())
+			}
+		}()
+
+		fn(c)
+	}()
+}
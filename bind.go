@@ -0,0 +1,311 @@
+package apiserv
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrUnsupportedContentType is returned from ctx.Bind if the request's content-type isn't supported,
+	// it usually should be returned as a 415 (http.StatusUnsupportedMediaType).
+	ErrUnsupportedContentType = errors.New("unsupported content-type")
+
+	// ErrInvalidBindTarget is returned from ctx.BindForm if out isn't a pointer to a struct.
+	ErrInvalidBindTarget = errors.New("out must be a pointer to a struct")
+)
+
+// Validator can be implemented by bind targets to be validated automatically after a successful bind,
+// returning a MultiError reports all the invalid fields at once.
+type Validator interface {
+	Validate() error
+}
+
+var validatorFn func(v interface{}) error
+
+// SetValidator sets a global validation func used by the binders for targets that don't implement Validator,
+// for example a wrapper around a struct tags based validation package. Passing nil disables it.
+// It is NOT safe to call once you call one of the run functions.
+func SetValidator(fn func(v interface{}) error) {
+	validatorFn = fn
+}
+
+func validate(v interface{}) error {
+	if vv, ok := v.(Validator); ok {
+		return vv.Validate()
+	}
+
+	if validatorFn != nil {
+		return validatorFn(v)
+	}
+
+	return nil
+}
+
+const maxFormMemory = 32 << 20 // 32mb, same as net/http
+
+// Bind parses the request's body based on its content-type using BindJSON, BindForm or BindXML,
+// defaults to BindJSON if the content-type is missing.
+// Returns ErrUnsupportedContentType for any other content-type.
+// All the binders validate out on success, see Validator.
+func (ctx *Context) Bind(out interface{}) error {
+	ct := ctx.ContentType()
+	if ct == "" {
+		return ctx.BindJSON(out)
+	}
+
+	ct, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return ErrUnsupportedContentType
+	}
+
+	switch {
+	case ct == "application/json", strings.HasSuffix(ct, "+json"):
+		return ctx.BindJSON(out)
+	case ct == "application/x-www-form-urlencoded", ct == "multipart/form-data":
+		return ctx.BindForm(out)
+	case ct == "application/xml", ct == "text/xml", strings.HasSuffix(ct, "+xml"):
+		return ctx.BindXML(out)
+	default:
+		return ErrUnsupportedContentType
+	}
+}
+
+// BindXML parses the request's body as xml, and closes the body.
+func (ctx *Context) BindXML(out interface{}) error {
+	err := xml.NewDecoder(ctx).Decode(out)
+	ctx.CloseBody()
+
+	if err != nil {
+		return err
+	}
+
+	return validate(out)
+}
+
+// BindForm parses the request's form (including the url query) into out, and closes the body.
+// out must be a pointer to a struct, fields are matched using the `form` tag, then the `json` tag, then the field name.
+// Supported field types are strings, bools, ints, uints, floats and slices of them.
+func (ctx *Context) BindForm(out interface{}) error {
+	req := ctx.Req
+
+	var err error
+	if ct, _, _ := mime.ParseMediaType(ctx.ContentType()); ct == "multipart/form-data" {
+		err = req.ParseMultipartForm(maxFormMemory)
+	} else {
+		err = req.ParseForm()
+	}
+	ctx.CloseBody()
+
+	if err != nil {
+		return err
+	}
+
+	if err = bindValues(req.Form, out); err != nil {
+		return err
+	}
+
+	return validate(out)
+}
+
+// BindMultipartJSON parses a multipart/form-data request with a JSON metadata part and a file, and closes the body.
+// The jsonField part (a text value or a file part) is decoded into out and validated, a missing part is returned as an *Error.
+// It returns the header of the first file that isn't jsonField, fields are checked in alphabetical order,
+// or http.ErrMissingFile if there isn't one.
+func (ctx *Context) BindMultipartJSON(jsonField string, out interface{}) (*multipart.FileHeader, error) {
+	req := ctx.Req
+	err := req.ParseMultipartForm(maxFormMemory)
+	ctx.CloseBody()
+
+	if err != nil {
+		return nil, err
+	}
+
+	form := req.MultipartForm
+
+	var b []byte
+	if v := form.Value[jsonField]; len(v) > 0 {
+		b = []byte(v[0])
+	} else if fhs := form.File[jsonField]; len(fhs) > 0 {
+		if b, err = readFileHeader(fhs[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(bytes.TrimSpace(b)) == 0 {
+		return nil, missingParam(jsonField)
+	}
+
+	if err = JSONUnmarshal(b, out); err != nil {
+		return nil, err
+	}
+
+	if err = validate(out); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(form.File))
+	for k, fhs := range form.File {
+		if k != jsonField && len(fhs) > 0 {
+			keys = append(keys, k)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, http.ErrMissingFile
+	}
+
+	sort.Strings(keys)
+	return form.File[keys[0]][0], nil
+}
+
+func readFileHeader(fh *multipart.FileHeader) ([]byte, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ioutil.ReadAll(f)
+}
+
+// BindHeader maps the request's headers into out's fields tagged with `header:"X-Name"`, untagged fields are ignored.
+// out must be a pointer to a struct, supported field types are the same as BindForm, missing headers are skipped.
+// Malformed values return a MultiError of *Error with the header name as the field.
+func (ctx *Context) BindHeader(out interface{}) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return ErrInvalidBindTarget
+	}
+
+	v = v.Elem()
+	t := v.Type()
+	h := ctx.Req.Header
+
+	var me MultiError
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("header")
+		if f.PkgPath != "" || name == "" || name == "-" {
+			continue
+		}
+
+		hv := h.Values(name)
+		if len(hv) == 0 {
+			continue
+		}
+
+		if err := setValue(v.Field(i), hv); err != nil {
+			me.Push(&Error{Message: err.Error(), Field: name})
+		}
+	}
+
+	if len(me) > 0 {
+		return me
+	}
+
+	return validate(out)
+}
+
+func bindValues(vals url.Values, out interface{}) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return ErrInvalidBindTarget
+	}
+
+	v = v.Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" { // unexported
+			continue
+		}
+
+		name := fieldName(f)
+		if name == "-" {
+			continue
+		}
+
+		fv, ok := vals[name]
+		if !ok || len(fv) == 0 {
+			continue
+		}
+
+		if err := setValue(v.Field(i), fv); err != nil {
+			return &Error{Message: err.Error(), Field: name}
+		}
+	}
+
+	return nil
+}
+
+func fieldName(f reflect.StructField) string {
+	for _, tag := range [...]string{"form", "json"} {
+		if name := strings.Split(f.Tag.Get(tag), ",")[0]; name != "" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+func setValue(v reflect.Value, vals []string) error {
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		sl := reflect.MakeSlice(v.Type(), len(vals), len(vals))
+		for i, s := range vals {
+			if err := setScalar(sl.Index(i), s); err != nil {
+				return err
+			}
+		}
+		v.Set(sl)
+		return nil
+	}
+
+	return setScalar(v, vals[0])
+}
+
+func setScalar(v reflect.Value, s string) (err error) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(s); err == nil {
+			v.SetBool(b)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		if n, err = strconv.ParseInt(s, 10, v.Type().Bits()); err == nil {
+			v.SetInt(n)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		if n, err = strconv.ParseUint(s, 10, v.Type().Bits()); err == nil {
+			v.SetUint(n)
+		}
+	case reflect.Float32, reflect.Float64:
+		var n float64
+		if n, err = strconv.ParseFloat(s, v.Type().Bits()); err == nil {
+			v.SetFloat(n)
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setScalar(v.Elem(), s)
+	default:
+		err = fmt.Errorf("unsupported type: %s", v.Type())
+	}
+
+	return
+}
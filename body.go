@@ -0,0 +1,78 @@
+package apiserv
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// DefaultCacheBodyLimit is the max body size used by ctx.RawBody and by CacheBody if maxBytes <= 0.
+const DefaultCacheBodyLimit = 10 << 20 // 10mb
+
+// ErrBodyTooLarge is returned from ctx.RawBody if the request's body is larger than the limit.
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// CacheBody is a middleware that buffers the request's body (up to maxBytes) so it can be read multiple times,
+// for example to verify a signature in a middleware then BindJSON in the handler, see ctx.RawBody.
+// Larger bodies get a 413 error response, maxBytes <= 0 uses DefaultCacheBodyLimit.
+func CacheBody(maxBytes int64) Handler {
+	if maxBytes <= 0 {
+		maxBytes = DefaultCacheBodyLimit
+	}
+
+	return func(ctx *Context) Response {
+		if _, err := ctx.cacheBody(maxBytes); err != nil {
+			if err == ErrBodyTooLarge {
+				return NewJSONErrorResponse(http.StatusRequestEntityTooLarge)
+			}
+			return NewJSONErrorResponse(http.StatusBadRequest, err)
+		}
+		return nil
+	}
+}
+
+// RawBody returns the request's body, if CacheBody wasn't used it reads and buffers the body (up to DefaultCacheBodyLimit)
+// so it can still be read by the other handlers.
+// The returned slice must not be modified.
+func (ctx *Context) RawBody() ([]byte, error) {
+	return ctx.cacheBody(DefaultCacheBodyLimit)
+}
+
+func (ctx *Context) cacheBody(maxBytes int64) ([]byte, error) {
+	req := ctx.Req
+	if cb, ok := req.Body.(*cachedBody); ok {
+		return cb.b, nil
+	}
+
+	var b []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		b, err = ioutil.ReadAll(io.LimitReader(req.Body, maxBytes+1))
+		req.Body.Close()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if int64(len(b)) > maxBytes {
+			return nil, ErrBodyTooLarge
+		}
+	}
+
+	req.Body = &cachedBody{Reader: bytes.NewReader(b), b: b}
+	return b, nil
+}
+
+// cachedBody is a re-readable request body.
+type cachedBody struct {
+	*bytes.Reader
+	b []byte
+}
+
+// Close rewinds the body so the next handler can read it again.
+func (cb *cachedBody) Close() error {
+	cb.Reset(cb.b)
+	return nil
+}
@@ -0,0 +1,163 @@
+package apiserv
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultBodyLogMaxBytes is the max logged size of each body used by BodyLogger if BodyLogOptions.MaxBytes <= 0.
+const DefaultBodyLogMaxBytes = 4 << 10 // 4kb
+
+// BodyLogOptions controls the BodyLogger middleware.
+type BodyLogOptions struct {
+	// MaxBytes is the max logged size of each body, defaults to DefaultBodyLogMaxBytes.
+	MaxBytes int
+
+	// Redact are the paths of JSON fields (ex: "password", "user.token") that are logged as "***",
+	// paths start at the body's root, so JSONResponse fields are under data (ex: "data.token"),
+	// arrays are walked so "items.secret" matches the secret field of every item.
+	// JSON bodies that can't be redacted (invalid or larger than MaxBytes) aren't logged,
+	// non-JSON bodies are logged as-is.
+	Redact []string
+}
+
+// BodyLogger is a middleware that logs the request and response bodies through the server's logger with the request's log prefix,
+// it should be added after any compression middleware so the plain response body is logged.
+// The request body is buffered so the handlers can still read it (see CacheBody),
+// bodies without a Content-Length or larger than DefaultCacheBodyLimit aren't logged.
+// Streaming (text/event-stream) and hijacked responses aren't logged.
+func BodyLogger(opts BodyLogOptions) Handler {
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = DefaultBodyLogMaxBytes
+	}
+
+	var paths [][]string
+	for _, p := range opts.Redact {
+		if p != "" {
+			paths = append(paths, strings.Split(p, "."))
+		}
+	}
+
+	return func(ctx *Context) Response {
+		s := ctx.s
+		if s == nil {
+			return nil
+		}
+
+		req := ctx.Req
+		if _, cached := req.Body.(*cachedBody); cached || (req.ContentLength > 0 && req.ContentLength <= DefaultCacheBodyLimit) {
+			if b, err := ctx.cacheBody(DefaultCacheBodyLimit); err == nil && len(b) > 0 {
+				s.Logf("%srequest body: %s", ctx.logPrefix(), formatLogBody(req.Header.Get("Content-Type"), b, len(b), opts.MaxBytes, paths))
+			}
+		} else if req.ContentLength != 0 && req.Body != nil && req.Body != http.NoBody {
+			s.Logf("%srequest body: <not logged, size: %d>", ctx.logPrefix(), req.ContentLength)
+		}
+
+		// buffer one extra byte to know if the body got truncated
+		tw := &tapRW{ResponseWriter: ctx.ResponseWriter, max: opts.MaxBytes + 1}
+		ctx.ResponseWriter = tw
+
+		ctx.Next()
+
+		ctx.ResponseWriter = tw.ResponseWriter
+		if tw.skip || len(tw.buf) == 0 {
+			return nil
+		}
+
+		size := len(tw.buf)
+		if size > opts.MaxBytes {
+			size = -1
+		}
+
+		s.Logf("%sresponse (%d) body: %s", ctx.logPrefix(), tw.status, formatLogBody(tw.Header().Get("Content-Type"), tw.buf, size, opts.MaxBytes, paths))
+		return nil
+	}
+}
+
+// formatLogBody formats b for logging, size is the full body's size or -1 if unknown.
+func formatLogBody(contentType string, b []byte, size, max int, redact [][]string) string {
+	truncated := size < 0 || size > max
+	if truncated && len(b) > max {
+		b = b[:max]
+	}
+
+	sizeStr := strconv.Itoa(size)
+	if size < 0 {
+		sizeStr = ">" + strconv.Itoa(max)
+	}
+
+	if strings.Contains(contentType, "json") && len(redact) > 0 {
+		if truncated || !json.Valid(b) {
+			return "<not logged, can't redact, size: " + sizeStr + ">"
+		}
+		b = redactJSON(b, redact)
+		if len(b) > max {
+			b, truncated = b[:max], true
+		}
+	}
+
+	if truncated { // drop a rune that got cut in half
+		for i := 0; i < utf8.UTFMax && len(b) > 0 && !utf8.Valid(b); i++ {
+			b = b[:len(b)-1]
+		}
+	}
+
+	if !utf8.Valid(b) {
+		return "<binary, size: " + sizeStr + ">"
+	}
+
+	if truncated {
+		return string(b) + "... (truncated, size: " + sizeStr + ")"
+	}
+
+	return string(b)
+}
+
+var redactedValue = json.RawMessage(`"***"`)
+
+// redactJSON replaces the values of the fields matching paths with "***", arrays are walked.
+func redactJSON(b []byte, paths [][]string) []byte {
+	var obj map[string]json.RawMessage
+	if err := JSONUnmarshal(b, &obj); err == nil && obj != nil {
+		for k, v := range obj {
+			var sub [][]string
+			for _, p := range paths {
+				if p[0] != k {
+					continue
+				}
+
+				if len(p) == 1 {
+					obj[k], sub = redactedValue, nil
+					break
+				}
+
+				sub = append(sub, p[1:])
+			}
+
+			if len(sub) > 0 {
+				obj[k] = redactJSON(v, sub)
+			}
+		}
+
+		if out, err := JSONMarshal(obj); err == nil {
+			return out
+		}
+		return b
+	}
+
+	var arr []json.RawMessage
+	if err := JSONUnmarshal(b, &arr); err == nil {
+		for i, v := range arr {
+			arr[i] = redactJSON(v, paths)
+		}
+
+		if out, err := JSONMarshal(arr); err == nil {
+			return out
+		}
+	}
+
+	return b
+}
@@ -0,0 +1,250 @@
+package apiserv
+
+import (
+	"container/list"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachedResponse is a response stored by the Cache middleware.
+type CachedResponse struct {
+	Status  int
+	Header  http.Header
+	Body    []byte
+	Created time.Time
+}
+
+// CacheStore stores the responses of the Cache middleware, implementations must be safe for concurrent use.
+type CacheStore interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, r *CachedResponse, ttl time.Duration)
+}
+
+// DefaultCacheMaxEntries is the size of the store used by Cache if CacheOptions.Store isn't set.
+const DefaultCacheMaxEntries = 1024
+
+// CacheOptions controls the Cache middleware.
+type CacheOptions struct {
+	// KeyFunc returns the cache key of the request, defaults to the method, path, query and Vary headers.
+	KeyFunc func(ctx *Context) string
+
+	// Vary are the request headers that are part of the default key, ex: Accept-Encoding.
+	Vary []string
+
+	// Store defaults to an in-memory LRU store with DefaultCacheMaxEntries entries.
+	Store CacheStore
+}
+
+// Cache is a middleware that caches the full response (status, headers and body) of GET requests for ttl,
+// cached responses are served with an Age header, HEAD requests are served from the GET cache.
+// Only 2xx responses are cached, streaming responses, ones with "Cache-Control: no-store" or "private"
+// and ones that set cookies are skipped, since they're specific to a user.
+func Cache(ttl time.Duration, opts CacheOptions) Handler {
+	store := opts.Store
+	if store == nil {
+		store = NewLRUCacheStore(DefaultCacheMaxEntries)
+	}
+
+	keyFn := opts.KeyFunc
+	if keyFn == nil {
+		vary := opts.Vary
+		keyFn = func(ctx *Context) string {
+			var sb strings.Builder
+			sb.WriteString(ctx.Req.URL.Path)
+			sb.WriteByte('?')
+			sb.WriteString(ctx.Req.URL.RawQuery)
+			for _, h := range vary {
+				sb.WriteByte('\n')
+				sb.WriteString(ctx.ReqHeader().Get(h))
+			}
+			return sb.String()
+		}
+	}
+
+	return func(ctx *Context) Response {
+		switch ctx.Req.Method {
+		case http.MethodGet, http.MethodHead:
+		default:
+			return nil
+		}
+
+		key := http.MethodGet + " " + keyFn(ctx)
+		if cr, ok := store.Get(key); ok && time.Since(cr.Created) < ttl {
+			h := ctx.Header()
+			for k, v := range cr.Header {
+				h[k] = append([]string(nil), v...)
+			}
+			h.Set("Age", strconv.Itoa(int(time.Since(cr.Created)/time.Second)))
+			ctx.WriteHeader(cr.Status)
+			ctx.Write(cr.Body)
+			return Break
+		}
+
+		if ctx.Req.Method != http.MethodGet {
+			return nil
+		}
+
+		rw := &recordRW{ResponseWriter: ctx.ResponseWriter}
+		ctx.ResponseWriter = rw
+		ctx.Next()
+		ctx.ResponseWriter = rw.ResponseWriter
+
+		if rw.status == 0 {
+			rw.status = http.StatusOK
+		}
+
+		if rw.skip || rw.status < 200 || rw.status > 299 || !cacheableHeader(rw.header) {
+			return nil
+		}
+
+		store.Set(key, &CachedResponse{
+			Status:  rw.status,
+			Header:  rw.header,
+			Body:    rw.buf.Bytes(),
+			Created: time.Now(),
+		}, ttl)
+
+		return nil
+	}
+}
+
+// cacheableHeader returns false for responses that must not be shared between clients.
+func cacheableHeader(h http.Header) bool {
+	if len(h.Values("Set-Cookie")) > 0 {
+		return false
+	}
+
+	cc := h.Get("Cache-Control")
+	return !strings.Contains(cc, "no-store") && !strings.Contains(cc, "private")
+}
+
+// NewLRUCacheStore returns an in-memory CacheStore that holds up to maxEntries responses,
+// evicting the least recently used ones.
+func NewLRUCacheStore(maxEntries int) CacheStore {
+	return &lruCacheStore{
+		m:   map[string]*list.Element{},
+		ll:  list.New(),
+		max: maxEntries,
+	}
+}
+
+type lruCacheEntry struct {
+	key     string
+	r       *CachedResponse
+	expires time.Time
+}
+
+type lruCacheStore struct {
+	mux sync.Mutex
+	m   map[string]*list.Element
+	ll  *list.List
+	max int
+}
+
+func (s *lruCacheStore) Get(key string) (*CachedResponse, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	el, ok := s.m[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*lruCacheEntry)
+	if time.Now().After(e.expires) {
+		s.ll.Remove(el)
+		delete(s.m, key)
+		return nil, false
+	}
+
+	s.ll.MoveToFront(el)
+	return e.r, true
+}
+
+func (s *lruCacheStore) Set(key string, r *CachedResponse, ttl time.Duration) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	e := &lruCacheEntry{key: key, r: r, expires: time.Now().Add(ttl)}
+	if el, ok := s.m[key]; ok {
+		el.Value = e
+		s.ll.MoveToFront(el)
+		return
+	}
+
+	s.m[key] = s.ll.PushFront(e)
+	for s.max > 0 && s.ll.Len() > s.max {
+		el := s.ll.Back()
+		s.ll.Remove(el)
+		delete(s.m, el.Value.(*lruCacheEntry).key)
+	}
+}
+
+// CacheControl builds a Cache-Control header, see ctx.SetCacheControl.
+type CacheControl struct {
+	// MaxAge is rounded down to seconds, only set if > 0.
+	MaxAge time.Duration
+
+	// Public and Private are mutually exclusive, Private wins if both are set.
+	Public  bool
+	Private bool
+
+	// NoStore overrides all the other directives.
+	NoStore bool
+
+	NoCache        bool
+	MustRevalidate bool
+
+	// StaleWhileRevalidate is rounded down to seconds, only set if > 0.
+	StaleWhileRevalidate time.Duration
+}
+
+// String returns the header value, directives are always in the same order.
+func (cc CacheControl) String() string {
+	if cc.NoStore {
+		return "no-store"
+	}
+
+	var parts []string
+	switch {
+	case cc.Private:
+		parts = append(parts, "private")
+	case cc.Public:
+		parts = append(parts, "public")
+	}
+
+	if cc.NoCache {
+		parts = append(parts, "no-cache")
+	}
+
+	if cc.MaxAge > 0 {
+		parts = append(parts, "max-age="+strconv.FormatInt(int64(cc.MaxAge/time.Second), 10))
+	}
+
+	if cc.MustRevalidate {
+		parts = append(parts, "must-revalidate")
+	}
+
+	if cc.StaleWhileRevalidate > 0 {
+		parts = append(parts, "stale-while-revalidate="+strconv.FormatInt(int64(cc.StaleWhileRevalidate/time.Second), 10))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// SetCacheControl sets the response's Cache-Control header, an empty CacheControl removes it.
+func (ctx *Context) SetCacheControl(cc CacheControl) {
+	if v := cc.String(); v != "" {
+		ctx.Header().Set("Cache-Control", v)
+	} else {
+		ctx.Header().Del("Cache-Control")
+	}
+}
+
+// NoStore sets "Cache-Control: no-store", should be used for responses with sensitive data.
+func (ctx *Context) NoStore() {
+	ctx.SetCacheControl(CacheControl{NoStore: true})
+}
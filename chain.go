@@ -0,0 +1,48 @@
+package apiserv
+
+// Chain is a reusable bundle of middlewares that can be applied per route or group, for example:
+//	authed := Chain{LogRequests(false), RequireAuth}
+//	srv.GET("/me", authed.Then(getMe))
+//	admin := authed.Append(RequireAdmin)
+//	srv.Group("admin", "/admin", admin...)
+// The handlers run in order, and like a route's handlers, returning a non-nil Response breaks the chain,
+// middlewares that call ctx.Next (ex: Timeout, LogRequests) wrap the rest of the chain and h.
+type Chain []Handler
+
+// Append returns a new Chain with mw added after the current handlers, the original Chain is not modified.
+func (c Chain) Append(mw ...Handler) Chain {
+	out := make(Chain, 0, len(c)+len(mw))
+	out = append(out, c...)
+	return append(out, mw...)
+}
+
+// Then returns a Handler that runs the chain's handlers then h, unless one of them returns a non-nil Response.
+// Responses are written the same way a route's handlers' are, the returned Response is the one that broke the chain.
+func (c Chain) Then(h Handler) Handler {
+	hc := c.Append(h)
+	return func(ctx *Context) Response {
+		// run the bundle through ctx.Next, then resume the outer chain
+		next, nextMW := ctx.next, ctx.nextMW
+		defer func() { ctx.next, ctx.nextMW = next, nextMW }()
+
+		var idx int
+		ctx.nextMW = nil
+		ctx.next = func() (r Response) {
+			for idx < len(hc) {
+				h := hc[idx]
+				idx++
+				if r = h(ctx); r != nil {
+					ctx.handleResponse(r)
+					break
+				}
+			}
+			ctx.next = nil
+			return
+		}
+
+		if r := ctx.Next(); r != nil || !ctx.done {
+			return r
+		}
+		return Break // a wrapping middleware returned nil after the response was written
+	}
+}
@@ -0,0 +1,71 @@
+package apiserv
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// ErrEmptyBody is returned from the json binding functions if the request's body is empty.
+var ErrEmptyBody = errors.New("empty request body")
+
+// JSONMarshal and JSONUnmarshal are used by ctx.JSON, ctx.BindJSON, JSONResponse and Error,
+// they default to encoding/json and can be replaced with a faster implementation using SetJSONCodec.
+// It is NOT safe to change them once you call one of the run functions.
+var (
+	JSONMarshal   func(v interface{}) ([]byte, error)    = json.Marshal
+	JSONUnmarshal func(data []byte, v interface{}) error = json.Unmarshal
+)
+
+// SetJSONCodec replaces the json functions used by the package, passing nil resets to encoding/json.
+func SetJSONCodec(marshal func(v interface{}) ([]byte, error), unmarshal func(data []byte, v interface{}) error) {
+	if marshal == nil {
+		marshal = json.Marshal
+	}
+
+	if unmarshal == nil {
+		unmarshal = json.Unmarshal
+	}
+
+	JSONMarshal, JSONUnmarshal = marshal, unmarshal
+}
+
+func jsonMarshal(v interface{}, indent bool) ([]byte, error) {
+	b, err := JSONMarshal(v)
+	if err != nil || !indent {
+		return b, err
+	}
+
+	var buf bytes.Buffer
+	if err = json.Indent(&buf, b, "", "\t"); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// IsJSONSyntaxError returns true if err is caused by malformed or truncated json.
+// Note that it only recognizes encoding/json errors, custom codecs may return their own types.
+func IsJSONSyntaxError(err error) bool {
+	var se *json.SyntaxError
+	return errors.As(err, &se) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// IsJSONTypeError returns the field (ex: "user.age") if err is caused by a json value not matching the go type.
+// Note that it only recognizes encoding/json errors, custom codecs may return their own types.
+func IsJSONTypeError(err error) (field string, ok bool) {
+	var te *json.UnmarshalTypeError
+	if !errors.As(err, &te) {
+		return "", false
+	}
+	return te.Field, true
+}
+
+// jsonDecodeError converts type errors to an *Error with the field set, other errors are returned as-is.
+func jsonDecodeError(err error) error {
+	if field, ok := IsJSONTypeError(err); ok {
+		return &Error{Message: err.Error(), Field: field}
+	}
+	return err
+}
@@ -2,6 +2,8 @@ package apiserv
 
 import (
 	"compress/gzip"
+	"compress/zlib"
+	"io"
 	"mime"
 	"net/http"
 	"os"
@@ -18,6 +20,27 @@ const (
 	gzEnc = "gzip"
 )
 
+// DisableCompression makes the compression middlewares (Gzip, Compression) pass the response through as-is,
+// it must be called before anything is written.
+// Streaming handlers (ex: sse) should call it since compression buffers the output,
+// responses with a text/event-stream content-type are detected automatically.
+func (ctx *Context) DisableCompression() {
+	switch w := ctx.ResponseWriter.(type) {
+	case *gzRW:
+		w.checked, w.bypass = true, true
+	case *compRW:
+		w.checked, w.bypass = true, true
+	default:
+		return
+	}
+	ctx.Header().Del(encodingHeader)
+}
+
+// isStreaming returns true for responses that must not be buffered.
+func isStreaming(h http.Header) bool {
+	return strings.HasPrefix(h.Get("Content-Type"), "text/event-stream")
+}
+
 func (ctx *Context) EnableGzip(level int) {
 	if _, ok := ctx.ResponseWriter.(*gzRW); ok {
 		return
@@ -73,6 +96,278 @@ func Gzip(level int) Handler {
 	}
 }
 
+// DefaultDecompressLimit is the max decompressed body size used by DecompressRequest if maxBytes <= 0.
+const DefaultDecompressLimit = 10 << 20 // 10mb
+
+// DecompressRequest is a middleware that transparently decompresses request bodies with a gzip or deflate Content-Encoding,
+// so BindJSON and friends see the plain body.
+// Reading more than maxBytes of decompressed data returns ErrBodyTooLarge to protect against zip bombs,
+// maxBytes <= 0 uses DefaultDecompressLimit.
+// Invalid streams get a 400 error response, and other encodings a 415.
+func DecompressRequest(maxBytes int64) Handler {
+	if maxBytes <= 0 {
+		maxBytes = DefaultDecompressLimit
+	}
+
+	return func(ctx *Context) Response {
+		req := ctx.Req
+		enc := strings.ToLower(strings.TrimSpace(req.Header.Get(encodingHeader)))
+
+		var (
+			zr  io.ReadCloser
+			err error
+		)
+
+		switch enc {
+		case "", "identity":
+			return nil
+		case gzEnc, "x-gzip":
+			zr, err = gzip.NewReader(req.Body)
+		case "deflate":
+			zr, err = zlib.NewReader(req.Body)
+		default:
+			return NewJSONErrorResponse(http.StatusUnsupportedMediaType, "unsupported content-encoding: "+enc)
+		}
+
+		if err != nil {
+			return NewJSONErrorResponse(http.StatusBadRequest, "invalid "+enc+" body: "+err.Error())
+		}
+
+		req.Body = &decompressedBody{zr: zr, body: req.Body, left: maxBytes}
+		req.Header.Del(encodingHeader)
+		req.Header.Del("Content-Length")
+		req.ContentLength = -1
+
+		return nil
+	}
+}
+
+type decompressedBody struct {
+	zr   io.ReadCloser
+	body io.Closer
+	left int64
+}
+
+func (d *decompressedBody) Read(p []byte) (n int, err error) {
+	if d.left <= 0 {
+		// check if there's more data before failing, exactly maxBytes is fine
+		var b [1]byte
+		if n, _ = d.zr.Read(b[:]); n > 0 {
+			return 0, ErrBodyTooLarge
+		}
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > d.left {
+		p = p[:d.left]
+	}
+
+	n, err = d.zr.Read(p)
+	d.left -= int64(n)
+	return
+}
+
+func (d *decompressedBody) Close() error {
+	d.zr.Close()
+	return d.body.Close()
+}
+
+// CompressorFunc returns a writer that compresses to w, level is the value set in CompressionOptions.Levels
+// or DefaultCompressionLevel.
+type CompressorFunc func(w io.Writer, level int) (io.WriteCloser, error)
+
+// DefaultCompressionLevel tells compressors to use their default level.
+const DefaultCompressionLevel = -1
+
+var (
+	compressorsMux sync.RWMutex
+	compressors    = map[string]CompressorFunc{}
+)
+
+// RegisterCompressor registers a compressor for the specific content-encoding to be used by the Compression middleware,
+// this keeps the dependencies optional, for example to enable brotli:
+//	apiserv.RegisterCompressor("br", func(w io.Writer, level int) (io.WriteCloser, error) {
+//		return brotli.NewWriterLevel(w, level), nil
+//	})
+// gzip is always supported and uses the built-in pooled writer unless overridden.
+func RegisterCompressor(encoding string, fn CompressorFunc) {
+	compressorsMux.Lock()
+	defer compressorsMux.Unlock()
+
+	if fn == nil {
+		delete(compressors, encoding)
+		return
+	}
+
+	compressors[encoding] = fn
+}
+
+func getCompressor(encoding string) CompressorFunc {
+	compressorsMux.RLock()
+	defer compressorsMux.RUnlock()
+	return compressors[encoding]
+}
+
+// CompressionOptions controls the Compression middleware.
+type CompressionOptions struct {
+	// Algorithms is the list of content-encodings to use in order of preference, defaults to br then gzip.
+	// Encodings without a registered compressor are ignored, except gzip.
+	Algorithms []string
+
+	// Levels are the per algorithm compression levels, missing ones use DefaultCompressionLevel.
+	Levels map[string]int
+}
+
+// Compression is a middleware that compresses responses using the best algorithm the client accepts,
+// the client's q values are respected, ties are broken by the order of opts.Algorithms.
+func Compression(opts CompressionOptions) Handler {
+	algos := opts.Algorithms
+	if len(algos) == 0 {
+		algos = []string{brEnc, gzEnc}
+	}
+
+	return func(ctx *Context) Response {
+		ctx.Header().Add("Vary", acceptHeader)
+
+		enc := negotiateEncoding(ctx.ReqHeader().Get(acceptHeader), algos)
+		if enc == "" {
+			return nil
+		}
+
+		level, ok := opts.Levels[enc]
+		if !ok {
+			level = DefaultCompressionLevel
+		}
+
+		if fn := getCompressor(enc); fn != nil {
+			ctx.enableCompressor(enc, fn, level)
+		} else {
+			ctx.EnableGzip(level)
+		}
+
+		return nil
+	}
+}
+
+func negotiateEncoding(h string, algos []string) string {
+	var (
+		best  string
+		bestQ float64
+	)
+
+	accepted := parseQualityList(h)
+	for _, a := range algos {
+		if a != gzEnc && getCompressor(a) == nil {
+			continue
+		}
+
+		// an explicit value takes precedence over *
+		var q, starQ float64
+		for _, qv := range accepted {
+			if strings.EqualFold(qv.value, a) {
+				q = qv.q
+				break
+			}
+			if qv.value == "*" && starQ == 0 {
+				starQ = qv.q
+			}
+		}
+
+		if q == 0 {
+			q = starQ
+		}
+
+		// algos are ordered by preference, so only a higher q replaces an earlier match
+		if q > bestQ {
+			best, bestQ = a, q
+		}
+	}
+
+	return best
+}
+
+func (ctx *Context) enableCompressor(enc string, fn CompressorFunc, level int) {
+	switch ctx.ResponseWriter.(type) {
+	case *gzRW, *compRW:
+		return
+	}
+
+	ctx.Header().Set(encodingHeader, enc)
+	ctx.ResponseWriter = &compRW{
+		ResponseWriter: ctx.ResponseWriter,
+		fn:             fn,
+		level:          level,
+	}
+}
+
+// compRW wraps a ResponseWriter with a registered compressor, the compressor is created on the first write.
+type compRW struct {
+	http.ResponseWriter
+	w       io.WriteCloser
+	fn      CompressorFunc
+	level   int
+	err     error
+	checked bool
+	bypass  bool
+}
+
+func (c *compRW) check() {
+	if c.checked {
+		return
+	}
+
+	c.checked = true
+	if c.bypass = isStreaming(c.Header()); c.bypass {
+		c.Header().Del(encodingHeader)
+	}
+}
+
+func (c *compRW) WriteHeader(code int) {
+	if c.check(); !c.bypass {
+		c.Header().Del("Content-Length")
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *compRW) Write(p []byte) (int, error) {
+	if c.check(); c.bypass {
+		return c.ResponseWriter.Write(p)
+	}
+
+	if c.w == nil && c.err == nil {
+		c.Header().Del("Content-Length")
+		c.w, c.err = c.fn(c.ResponseWriter, c.level)
+	}
+
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	return c.w.Write(p)
+}
+
+// Unwrap returns the original ResponseWriter, used by http.ResponseController.
+func (c *compRW) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+func (c *compRW) Flush() {
+	if f, ok := c.w.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+
+	if hf, ok := c.ResponseWriter.(http.Flusher); ok {
+		hf.Flush()
+	}
+}
+
+func (c *compRW) Close() error {
+	if c.w == nil {
+		return nil
+	}
+	return c.w.Close()
+}
+
 var (
 	gzpools [gzip.BestCompression + 1]sync.Pool
 	gzonce  sync.Once
@@ -107,8 +402,28 @@ func newGzipRW(level int) *gzRW {
 
 type gzRW struct {
 	http.ResponseWriter
-	gw    *gzip.Writer
-	level int
+	gw      *gzip.Writer
+	level   int
+	checked bool
+	bypass  bool
+}
+
+func (g *gzRW) check() {
+	if g.checked {
+		return
+	}
+
+	g.checked = true
+	if g.bypass = isStreaming(g.Header()); g.bypass {
+		g.Header().Del(encodingHeader)
+	} else {
+		g.Header().Del("Content-Length") // the compressed size is different
+	}
+}
+
+func (g *gzRW) WriteHeader(code int) {
+	g.check()
+	g.ResponseWriter.WriteHeader(code)
 }
 
 func (g *gzRW) init(ctx *Context) {
@@ -120,11 +435,21 @@ func (g *gzRW) init(ctx *Context) {
 }
 
 func (g *gzRW) Write(p []byte) (int, error) {
+	if g.check(); g.bypass {
+		return g.ResponseWriter.Write(p)
+	}
 	return g.gw.Write(p)
 }
 
+// Unwrap returns the original ResponseWriter, used by http.ResponseController.
+func (g *gzRW) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
 func (g *gzRW) Flush() {
-	g.gw.Flush()
+	if !g.bypass {
+		g.gw.Flush()
+	}
 
 	if hf, ok := g.ResponseWriter.(http.Flusher); ok {
 		hf.Flush()
@@ -132,7 +457,11 @@ func (g *gzRW) Flush() {
 }
 
 func (g *gzRW) Reset() {
-	g.gw.Close()
+	if !g.bypass {
+		g.gw.Close()
+	}
+	g.checked, g.bypass = false, false
+
 	if hf, ok := g.ResponseWriter.(http.Flusher); ok {
 		hf.Flush()
 	}
@@ -1,15 +1,21 @@
 package apiserv
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"mime"
 	"mime/multipart"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -30,6 +36,13 @@ var (
 
 	// ErrEmptyData is returned when the data payload is empty
 	ErrEmptyData = errors.New("empty data")
+
+	// ErrPushNotSupported is returned from ctx.Push if the connection doesn't support HTTP/2 server push.
+	ErrPushNotSupported = errors.New("http/2 server push is not supported")
+
+	// ErrTrailersNotSupported is returned from ctx.SetTrailer if the response can't have trailers,
+	// ex: HTTP/1.0 requests or responses with a Content-Length.
+	ErrTrailersNotSupported = errors.New("trailers are not supported")
 )
 
 // Context is the default context passed to handlers
@@ -42,9 +55,17 @@ type Context struct {
 	s                  *Server
 	next               func() Response
 	Params             router.Params
+	onResp             []func(status, bytes int)
 	status             int
+	written            int
 	hijackServeContent bool
 	done               bool
+	clientGone         bool
+	nextStatus         int
+	timeout            context.Context
+	errs               []error
+	respWritten        bool // a response returned by the chain was written, see handleResponse
+	star               string   // the route's catch-all param name, see Wildcard
 }
 
 // Param is a shorthand for ctx.Params.Get(name).
@@ -52,6 +73,14 @@ func (ctx *Context) Param(key string) string {
 	return ctx.Params.Get(key)
 }
 
+// ParamDefault returns the path param key or a default value if it's empty.
+func (ctx *Context) ParamDefault(key, def string) string {
+	if v := ctx.Params.Get(key); v != "" {
+		return v
+	}
+	return def
+}
+
 // Query is a shorthand for ctx.Req.URL.Query().Get(key).
 func (ctx *Context) Query(key string) string {
 	return ctx.Req.URL.Query().Get(key)
@@ -65,14 +94,74 @@ func (ctx *Context) QueryDefault(key, def string) string {
 	return def
 }
 
-// Get returns a context value
+// QueryInt returns the query key as an int or a default value if it's missing or not a valid int.
+func (ctx *Context) QueryInt(key string, def int) int {
+	if n, err := strconv.Atoi(ctx.Req.URL.Query().Get(key)); err == nil {
+		return n
+	}
+	return def
+}
+
+// QueryArray returns all the values of the query key (ex: ?tag=a&tag=b), it never returns nil.
+func (ctx *Context) QueryArray(key string) []string {
+	if v := ctx.Req.URL.Query()[key]; len(v) > 0 {
+		return v
+	}
+	return []string{}
+}
+
+// QueryMap returns the query params in the prefix[key]=value form (ex: ?f[name]=x&f[age]=1) as a map, it never returns nil.
+// For repeated keys the first value is used.
+func (ctx *Context) QueryMap(prefix string) map[string]string {
+	out := map[string]string{}
+	for k, v := range ctx.Req.URL.Query() {
+		if len(k) < len(prefix)+2 || !strings.HasPrefix(k, prefix) || k[len(prefix)] != '[' || k[len(k)-1] != ']' {
+			continue
+		}
+
+		if key := k[len(prefix)+1 : len(k)-1]; key != "" && len(v) > 0 {
+			out[key] = v[0]
+		}
+	}
+	return out
+}
+
+// ContextKey is the type of the keys used to store ctx.Set values in the request's context.Context,
+// see the PropagateContextValues option.
+type ContextKey string
+
+// Get returns a context value, falling back to the request's context.Context value stored under ContextKey(key).
+// Values set using ctx.Set take precedence over the request context's.
 func (ctx *Context) Get(key string) interface{} {
-	return ctx.data[key]
+	if v, ok := ctx.data[key]; ok {
+		return v
+	}
+
+	if ctx.Req != nil {
+		return ctx.Req.Context().Value(ContextKey(key))
+	}
+
+	return nil
 }
 
-// Set sets a context value, useful in passing data to other handlers down the chain
+// Set sets a context value, useful in passing data to other handlers down the chain.
+// If the PropagateContextValues option is enabled, the value is also stored in ctx.Req's context under ContextKey(key),
+// so libraries using req.Context().Value can see it.
 func (ctx *Context) Set(key string, val interface{}) {
 	ctx.data[key] = val
+
+	if ctx.s != nil && ctx.s.opts.PropagateContextValues && ctx.Req != nil {
+		ctx.Req = ctx.Req.WithContext(context.WithValue(ctx.Req.Context(), ContextKey(key), val))
+	}
+}
+
+// ClaimsContextKey is the key used by auth middlewares (see apiutils.JWTAuth) to store the parsed token claims.
+const ClaimsContextKey = ":JWTC:"
+
+// Claims returns the token claims set by an auth middleware, if any.
+func (ctx *Context) Claims() (map[string]interface{}, bool) {
+	m, ok := ctx.Get(ClaimsContextKey).(map[string]interface{})
+	return m, ok
 }
 
 // WriteReader outputs the data from the passed reader with optional content-type.
@@ -84,15 +173,176 @@ func (ctx *Context) WriteReader(contentType string, r io.Reader) (int64, error)
 	return io.Copy(ctx, r)
 }
 
-// File serves a file using http.ServeContent.
+// Stream sets the content-type, writes the headers and keeps calling step, flushing after every call,
+// until it returns false, a write fails or the client disconnects, in which case the request context's error is returned.
+// calling this function marks the Context as done, meaning any returned responses won't be written out.
+//	return ctx.Stream("text/csv", func(w io.Writer) bool {
+//		row, ok := nextRow()
+//		if ok {
+//			csvWriter.Write(w, row)
+//		}
+//		return ok
+//	})
+func (ctx *Context) Stream(contentType string, step func(w io.Writer) bool) error {
+	ctx.done = true
+	ctx.SetContentType(contentType)
+	ctx.WriteHeader(http.StatusOK)
+	ctx.Flush()
+
+	var (
+		rctx = ctx.Req.Context()
+		w    = &stickyErrWriter{w: ctx}
+	)
+
+	for {
+		select {
+		case <-rctx.Done():
+			return rctx.Err()
+		default:
+		}
+
+		more := step(w)
+		if w.err != nil {
+			return w.err
+		}
+
+		ctx.Flush()
+
+		if !more {
+			return nil
+		}
+	}
+}
+
+// stickyErrWriter keeps returning the first write error it gets.
+type stickyErrWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *stickyErrWriter) Write(p []byte) (n int, err error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	n, w.err = w.w.Write(p)
+	return n, w.err
+}
+
+var openFile = func(fp string) (io.ReadSeekCloser, os.FileInfo, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	return f, fi, nil
+}
+
+// File serves a file using http.ServeContent, the copy stops if the client disconnects.
+// Directories are served using http.ServeFile.
 // See http.ServeContent.
 func (ctx *Context) File(fp string) error {
 	ctx.hijackServeContent = true
-	http.ServeFile(ctx, ctx.Req, fp)
+
+	if strings.HasSuffix(ctx.Req.URL.Path, "/index.html") { // let ServeFile handle the redirect
+		http.ServeFile(ctx, ctx.Req, fp)
+		return nil
+	}
+
+	f, fi, err := openFile(fp)
+	if err != nil || fi.IsDir() {
+		if f != nil {
+			f.Close()
+		}
+		// handles the errors and directory listing
+		http.ServeFile(ctx, ctx.Req, fp)
+		return nil
+	}
+	defer f.Close()
+
+	http.ServeContent(ctx, ctx.Req, fi.Name(), fi.ModTime(), ctxReadSeeker{ctx.Req.Context(), f})
 
 	return nil
 }
 
+// ServeReader serves the content of rs using http.ServeContent, supporting range and conditional requests
+// for in-memory or generated content, the content-type is detected from name's extension or sniffed from the content.
+// The copy stops if the client disconnects.
+// calling this function marks the Context as done, meaning any returned responses won't be written out.
+// See http.ServeContent.
+func (ctx *Context) ServeReader(name string, modtime time.Time, rs io.ReadSeeker) error {
+	ctx.done = true
+	ctx.hijackServeContent = true
+	http.ServeContent(ctx, ctx.Req, name, modtime, ctxReadSeeker{ctx.Req.Context(), rs})
+
+	return nil
+}
+
+// ctxReadSeeker stops reading once ctx is done, used to stop copying to disconnected clients.
+type ctxReadSeeker struct {
+	ctx context.Context
+	io.ReadSeeker
+}
+
+func (r ctxReadSeeker) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.ReadSeeker.Read(p)
+}
+
+// Attachment outputs the data from the passed reader as a download named filename,
+// the content-type is detected from the filename's extension.
+// If r is an *os.File, its size is used for the Content-Length header, unless the response is compressed.
+func (ctx *Context) Attachment(filename string, r io.Reader) error {
+	return ctx.attachment(filename, mime.TypeByExtension(filepath.Ext(filename)), r)
+}
+
+func (ctx *Context) attachment(filename, contentType string, r io.Reader) error {
+	if contentType == "" {
+		contentType = MimeBinary
+	}
+
+	h := ctx.Header()
+	setAttachment(h, filename)
+
+	if f, ok := r.(*os.File); ok && h.Get(encodingHeader) == "" {
+		if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+			h.Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+		}
+	}
+
+	ctx.done = true
+	_, err := ctx.WriteReader(contentType, r)
+	return err
+}
+
+func setAttachment(h http.Header, filename string) {
+	if cd := mime.FormatMediaType("attachment", map[string]string{"filename": filename}); cd != "" {
+		h.Set("Content-Disposition", cd)
+	} else {
+		h.Set("Content-Disposition", "attachment")
+	}
+}
+
+// SendFile serves a file like ctx.File (supporting range and conditional requests),
+// if download is true, it's sent as an attachment named after the file's base name.
+func (ctx *Context) SendFile(fp string, download bool) error {
+	if download {
+		if fi, err := os.Stat(fp); err == nil && fi.Mode().IsRegular() {
+			setAttachment(ctx.Header(), filepath.Base(fp))
+		}
+	}
+
+	return ctx.File(fp)
+}
+
 // Path is a shorthand for ctx.Req.URL.EscapedPath().
 func (ctx *Context) Path() string {
 	return ctx.Req.URL.EscapedPath()
@@ -108,6 +358,170 @@ func (ctx *Context) SetContentType(typ string) {
 	h.Set("X-Content-Type-Options", "nosniff") // fixes IE xss exploit
 }
 
+// SetHeaders sets the response headers in h, overwriting any existing values.
+func (ctx *Context) SetHeaders(h map[string]string) {
+	rh := ctx.Header()
+	for k, v := range h {
+		rh.Set(k, v)
+	}
+}
+
+// AddHeader appends a value to a response header, useful for multi-valued headers like Link.
+func (ctx *Context) AddHeader(key, value string) {
+	ctx.Header().Add(key, value)
+}
+
+// Accepts returns the mime from mimes the request's Accept header prefers, respecting q-values and wildcards (ex: text/*),
+// ties are broken by the order of mimes. It returns mimes[0] if there's no Accept header, and an empty string if none match.
+func (ctx *Context) Accepts(mimes ...string) string {
+	if len(mimes) == 0 {
+		return ""
+	}
+
+	h := ctx.ReqHeader().Get("Accept")
+	if h == "" {
+		return mimes[0]
+	}
+
+	var (
+		accepted = parseQualityList(h)
+		best     string
+		bestQ    float64
+	)
+
+	for _, m := range mimes {
+		if q := mimeQuality(accepted, m); q > bestQ {
+			best, bestQ = m, q
+		}
+	}
+
+	return best
+}
+
+// AcceptsJSON returns true if the request accepts json responses.
+func (ctx *Context) AcceptsJSON() bool {
+	return ctx.Accepts("application/json") != ""
+}
+
+// AcceptsHTML returns true if the request accepts html responses.
+func (ctx *Context) AcceptsHTML() bool {
+	return ctx.Accepts("text/html") != ""
+}
+
+// mimeQuality returns the q-value of the most specific accepted range matching mime, params are ignored.
+func mimeQuality(accepted []qualityValue, mime string) float64 {
+	if idx := strings.IndexByte(mime, ';'); idx != -1 {
+		mime = mime[:idx]
+	}
+	mime = strings.ToLower(strings.TrimSpace(mime))
+
+	typ := mime
+	if idx := strings.IndexByte(mime, '/'); idx != -1 {
+		typ = mime[:idx]
+	}
+
+	var (
+		q    float64
+		spec = -1
+	)
+
+	for _, qv := range accepted {
+		var s int
+		switch v := strings.ToLower(qv.value); v {
+		case mime:
+			s = 2
+		case typ + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		default:
+			continue
+		}
+
+		if s > spec {
+			spec, q = s, qv.q
+		}
+	}
+
+	return q
+}
+
+// prefersMime returns true if accept explicitly lists one of mimes (wildcards don't count)
+// with a q-value that isn't lower than json's, used to pick alternative encodings of a JSONResponse.
+func prefersMime(accept string, mimes ...string) bool {
+	if accept == "" {
+		return false
+	}
+
+	accepted := parseQualityList(accept)
+	jsonQ := mimeQuality(accepted, "application/json")
+	for _, qv := range accepted {
+		for _, m := range mimes {
+			if strings.EqualFold(qv.value, m) && qv.q >= jsonQ {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// SetTrailer sets a response trailer, for example the final status of a streaming response.
+// If called before the response is written, the trailer is also announced in the Trailer header,
+// it can be called again after the body is written to update the value.
+// It returns ErrTrailersNotSupported for HTTP/1.0 requests and responses with a Content-Length, since they aren't chunked.
+func (ctx *Context) SetTrailer(key, value string) error {
+	h := ctx.Header()
+	if !ctx.Req.ProtoAtLeast(1, 1) || (ctx.Req.ProtoMajor == 1 && h.Get("Content-Length") != "") {
+		return ErrTrailersNotSupported
+	}
+
+	key = http.CanonicalHeaderKey(key)
+	if ctx.status == 0 && !ctx.done {
+		h.Add("Trailer", key)
+	}
+
+	h.Set(http.TrailerPrefix+key, value)
+	return nil
+}
+
+// PreferredLanguage returns the best match from supported based on the request's Accept-Language header,
+// a language without a region matches any of its regions (ex: "en" matches "en-US" and vice versa).
+// Falls back to the first supported language.
+func (ctx *Context) PreferredLanguage(supported []string) string {
+	if len(supported) == 0 {
+		return ""
+	}
+
+	for _, qv := range parseQualityList(ctx.ReqHeader().Get("Accept-Language")) {
+		if qv.value == "*" {
+			break
+		}
+
+		for _, lang := range supported {
+			if strings.EqualFold(qv.value, lang) {
+				return lang
+			}
+		}
+
+		base := langBase(qv.value)
+		for _, lang := range supported {
+			if strings.EqualFold(base, langBase(lang)) {
+				return lang
+			}
+		}
+	}
+
+	return supported[0]
+}
+
+func langBase(lang string) string {
+	if idx := strings.IndexAny(lang, "-_"); idx != -1 {
+		return lang[:idx]
+	}
+	return lang
+}
+
 // ReqHeader returns the request header.
 func (ctx *Context) ReqHeader() http.Header {
 	return ctx.Req.Header
@@ -124,17 +538,91 @@ func (ctx *Context) Read(p []byte) (int, error) {
 	return ctx.Req.Body.Read(p)
 }
 
+// ExpectsContinue returns true if the client sent an "Expect: 100-continue" header and is waiting before sending the body,
+// returning a response without reading the body rejects the request without receiving it.
+func (ctx *Context) ExpectsContinue() bool {
+	return expectsContinue(ctx.Req)
+}
+
 // CloseBody closes the request body.
 func (ctx *Context) CloseBody() error {
 	return ctx.Req.Body.Close()
 }
 
 // BindJSON parses the request's body as json, and closes the body.
+// Returns ErrEmptyBody if the body is empty, see IsJSONSyntaxError and IsJSONTypeError for other failures.
+// out is validated on success, see Validator.
 // Note that unlike gin.Context.Bind, this does NOT verify the fields using special tags.
 func (ctx *Context) BindJSON(out interface{}) error {
-	err := json.NewDecoder(ctx).Decode(out)
+	b, err := ioutil.ReadAll(ctx)
 	ctx.CloseBody()
-	return err
+	if err != nil {
+		return err
+	}
+
+	if len(bytes.TrimSpace(b)) == 0 {
+		return ErrEmptyBody
+	}
+
+	if err = JSONUnmarshal(b, out); err != nil {
+		return err
+	}
+
+	return validate(out)
+}
+
+// BindJSONOptional is like BindJSON, but an empty body isn't an error, present is false and out is left as-is,
+// useful for PATCH-style endpoints where "no body" and a malformed body mean different things.
+func (ctx *Context) BindJSONOptional(out interface{}) (present bool, err error) {
+	if err = ctx.BindJSON(out); err == ErrEmptyBody {
+		return false, nil
+	}
+	return true, err
+}
+
+// MustBindJSON is like BindJSON, but on failure it writes a 400 error response, marks the Context as done and returns it.
+// Unlike the MustParam* helpers, the response is already written, returning it from the handler is a no-op, example:
+//	if r := ctx.MustBindJSON(&req); r != nil {
+//		return r
+//	}
+func (ctx *Context) MustBindJSON(out interface{}) Response {
+	if err := ctx.BindJSON(out); err != nil {
+		r := NewJSONErrorResponse(http.StatusBadRequest, jsonDecodeError(err))
+		ctx.respWritten = true // returning it from the handler is expected, see handleResponse
+		ctx.writeResponse(r)
+		ctx.done = true
+		return r
+	}
+	return nil
+}
+
+// BindJSONWithLimit is a strict version of BindJSON, it fails if the body is larger than maxBytes
+// or if it contains fields that don't exist in out.
+// Unknown fields are returned as an *Error with the Field set.
+// Note that it always uses encoding/json, regardless of SetJSONCodec.
+func (ctx *Context) BindJSONWithLimit(out interface{}, maxBytes int64) error {
+	const unknownField = "json: unknown field "
+
+	dec := json.NewDecoder(http.MaxBytesReader(ctx.ResponseWriter, ctx.Req.Body, maxBytes))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(out)
+	ctx.CloseBody()
+
+	if err == io.EOF {
+		return ErrEmptyBody
+	}
+
+	if err != nil && strings.HasPrefix(err.Error(), unknownField) {
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), unknownField))
+		return &Error{Message: err.Error(), Field: field}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return validate(out)
 }
 
 // BindJSONP parses the request's callback and data search queries and closes the body
@@ -193,26 +681,37 @@ func (ctx *Context) JSON(code int, indent bool, v interface{}) error {
 	ctx.done = true
 	ctx.SetContentType(MimeJSON)
 
-	enc := json.NewEncoder(ctx)
+	b, err := jsonMarshal(v, indent)
 
-	if indent {
-		enc.SetIndent("", "\t")
+	// compressed responses can't know their length upfront
+	if err == nil && ctx.s != nil && ctx.s.opts.BufferJSONResponses && ctx.Header().Get(encodingHeader) == "" {
+		ctx.Header().Set("Content-Length", strconv.Itoa(len(b)+1))
 	}
 
 	if code > 0 {
 		ctx.WriteHeader(code)
 	}
 
-	err := enc.Encode(v)
 	if err != nil {
-		ctx.s.Logf("json error: %v", err)
+		if ctx.s != nil {
+			ctx.s.Logf("json error: %v", err)
+		}
+		return err
 	}
+
+	_, err = ctx.Write(append(b, '\n'))
 	return err
 }
 
 // JSONP outputs a jsonP object, it is highly recommended to return *Response rather than use this directly.
+// callbackKey is replaced with console.error if it isn't valid, see SetJSONPCallbackValidator.
 // calling this function marks the Context as done, meaning any returned responses won't be written out.
 func (ctx *Context) JSONP(code int, callbackKey string, v interface{}) (err error) {
+	if !jsonpCallbackValidator(callbackKey) {
+		ctx.Logf("invalid jsonp callback: %q", callbackKey)
+		callbackKey = "console.error"
+	}
+
 	ctx.done = true
 	ctx.SetContentType(MimeJavascript)
 
@@ -229,6 +728,18 @@ func (ctx *Context) JSONP(code int, callbackKey string, v interface{}) (err erro
 	return
 }
 
+// Error returns a JSON error response with the specific code, it is a shortcut for NewJSONErrorResponse, example:
+//	return ctx.Error(http.StatusNotFound, "user not found")
+// errs accepts the same types as NewJSONErrorResponse, if none are passed the status text is used.
+func (ctx *Context) Error(code int, errs ...interface{}) *JSONResponse {
+	return NewJSONErrorResponse(code, errs...)
+}
+
+// JSONError is an alias for ctx.Error.
+func (ctx *Context) JSONError(code int, errs ...interface{}) *JSONResponse {
+	return NewJSONErrorResponse(code, errs...)
+}
+
 // ClientIP returns the current client ip, accounting for X-Real-Ip and X-forwarded-For headers as well.
 func (ctx *Context) ClientIP() string {
 	h := ctx.Req.Header
@@ -282,10 +793,28 @@ func (ctx *Context) Next() Response {
 	return ctx.NextHandler()
 }
 
+// AbortWithStatus writes the status code without a body, marks the Context as done and returns Break to stop the chain,
+// the header isn't written again if the Context is already done, example:
+//	if !allowed {
+//		return ctx.AbortWithStatus(http.StatusForbidden)
+//	}
+func (ctx *Context) AbortWithStatus(code int) Response {
+	if !ctx.done {
+		ctx.done = true
+		ctx.WriteHeader(code)
+	}
+	return Break
+}
+
 // WriteHeader and Write are to implement ResponseWriter and allows ghetto hijacking of http.ServeContent errors,
 // without them we'd end up with plain text errors, we wouldn't want that, would we?
 // WriteHeader implements http.ResponseWriter
 func (ctx *Context) WriteHeader(s int) {
+	if s == http.StatusOK && ctx.nextStatus > 0 {
+		s = ctx.nextStatus
+	}
+	ctx.nextStatus = 0
+
 	if ctx.status = s; ctx.hijackServeContent && ctx.status >= http.StatusBadRequest {
 		return
 	}
@@ -303,7 +832,86 @@ func (ctx *Context) Write(p []byte) (int, error) {
 
 	ctx.done = true
 
-	return ctx.ResponseWriter.Write(p)
+	if ctx.nextStatus > 0 { // nothing called WriteHeader yet
+		ctx.WriteHeader(ctx.nextStatus)
+	}
+
+	n, err := ctx.ResponseWriter.Write(p)
+	ctx.written += n
+
+	if err != nil && IsClientDisconnect(err) {
+		ctx.clientGone = true
+	}
+
+	return n, err
+}
+
+// Flush sends any buffered data to the client if the underlying ResponseWriter supports it, otherwise it's a no-op.
+// Context implements http.Flusher.
+func (ctx *Context) Flush() {
+	if f, ok := ctx.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Push initiates an HTTP/2 server push of target (see http.Pusher), opts can be nil.
+// It returns ErrPushNotSupported under HTTP/1.x and httptest.ResponseRecorder, callers should treat that as a no-op.
+// Note that most browsers dropped support for server push, the client can also disable it (http.ErrNotSupported).
+func (ctx *Context) Push(target string, opts *http.PushOptions) error {
+	w := ctx.ResponseWriter
+	for {
+		if p, ok := w.(http.Pusher); ok {
+			return p.Push(target, opts)
+		}
+
+		// middlewares (ex: Gzip) wrap the original ResponseWriter
+		uw, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return ErrPushNotSupported
+		}
+		w = uw.Unwrap()
+	}
+}
+
+// CanFlush returns true if the underlying ResponseWriter supports flushing.
+func (ctx *Context) CanFlush() bool {
+	_, ok := ctx.ResponseWriter.(http.Flusher)
+	return ok
+}
+
+// BytesWritten returns the number of bytes written to the response body so far.
+func (ctx *Context) BytesWritten() int {
+	return ctx.written
+}
+
+// OnResponse registers fn to be called after the handler chain completes (even if it panicked),
+// with the final status code and the number of bytes written.
+// Multiple hooks are called in the order they were registered.
+func (ctx *Context) OnResponse(fn func(status, bytes int)) {
+	ctx.onResp = append(ctx.onResp, fn)
+}
+
+func (ctx *Context) runOnResponse(panicked bool) {
+	if len(ctx.onResp) == 0 {
+		return
+	}
+
+	status := ctx.Status()
+	if panicked && ctx.written == 0 {
+		status = http.StatusInternalServerError
+	}
+
+	for _, fn := range ctx.onResp {
+		fn(status, ctx.written)
+	}
+}
+
+// SetStatus sets the status code to be used when the response gets written, without writing the headers,
+// for example a middleware can set 201 and the handler's returned JSONResponse will be written with it.
+// It only replaces a 200 status, any other code set by the response (ex: an error) takes precedence,
+// the same applies to calling WriteHeader directly, WriteHeader(200) writes the pending status instead.
+func (ctx *Context) SetStatus(code int) {
+	ctx.nextStatus = code
 }
 
 // Status returns last value written using WriteHeader.
@@ -338,8 +946,56 @@ func (ctx *Context) MultipartReader() (*multipart.Reader, error) {
 }
 
 // Done returns wither the context is marked as done or not.
+// Note that because of it, Context can't implement context.Context, use ctx.StdContext() instead.
 func (ctx *Context) Done() bool { return ctx.done }
 
+// StdContext returns a context.Context to pass to database / client calls, it's the request's context
+// (canceled when the client disconnects), with the values set using ctx.Set available using their string keys.
+// The values are copied when it's called, later calls to ctx.Set aren't reflected.
+func (ctx *Context) StdContext() context.Context {
+	rctx := ctx.Req.Context()
+	if len(ctx.data) == 0 {
+		return rctx
+	}
+
+	data := make(M, len(ctx.data))
+	for k, v := range ctx.data {
+		data[k] = v
+	}
+
+	return stdContext{rctx, data}
+}
+
+type stdContext struct {
+	context.Context
+	data M
+}
+
+func (c stdContext) Value(key interface{}) interface{} {
+	if k, ok := key.(string); ok {
+		if v, ok := c.data[k]; ok {
+			return v
+		}
+	}
+	return c.Context.Value(key)
+}
+
+// RemainingTime returns the time left until the request context's deadline, for example one set by a middleware
+// using context.WithTimeout, so handlers can budget timeouts of downstream calls.
+// It returns (0, false) if the request has no deadline, and (0, true) if it already passed.
+func (ctx *Context) RemainingTime() (time.Duration, bool) {
+	dl, ok := ctx.Req.Context().Deadline()
+	if !ok {
+		return 0, false
+	}
+
+	if d := time.Until(dl); d > 0 {
+		return d, true
+	}
+
+	return 0, true
+}
+
 // SetCookie sets an http-only cookie using the passed name, value and domain.
 // Returns an error if there was a problem encoding the value.
 // if forceSecure is true, it will set the Secure flag to true, otherwise it sets it based on the connection.
@@ -440,8 +1096,11 @@ func getCtx(rw http.ResponseWriter, req *http.Request, p router.Params, s *Serve
 }
 
 func putCtx(ctx *Context) {
-	if g, ok := ctx.ResponseWriter.(*gzRW); ok {
-		g.Reset()
+	switch w := ctx.ResponseWriter.(type) {
+	case *gzRW:
+		w.Reset()
+	case *compRW:
+		w.Close()
 	}
 
 	// trying to fix a race in api
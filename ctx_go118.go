@@ -0,0 +1,15 @@
+//go:build go1.18
+// +build go1.18
+
+package apiserv
+
+// GetValue is a type-safe version of ctx.Get, ok is false if the key doesn't exist or isn't of type T.
+func GetValue[T any](ctx *Context, key string) (v T, ok bool) {
+	v, ok = ctx.Get(key).(T)
+	return
+}
+
+// SetValue is a type-safe version of ctx.Set, use GetValue to retrieve the value.
+func SetValue[T any](ctx *Context, key string, v T) {
+	ctx.Set(key, v)
+}
@@ -0,0 +1,16 @@
+//go:build go1.20
+// +build go1.20
+
+package apiserv
+
+import (
+	"net/http"
+	"time"
+)
+
+// SetWriteDeadline sets the write deadline of the underlying connection, overriding the server's WriteTimeout
+// for this response, useful for long streaming responses.
+// Returns an error wrapping http.ErrNotSupported if the ResponseWriter doesn't support it.
+func (ctx *Context) SetWriteDeadline(t time.Time) error {
+	return http.NewResponseController(ctx.ResponseWriter).SetWriteDeadline(t)
+}
@@ -0,0 +1,43 @@
+//go:build go1.20
+// +build go1.20
+
+package apiserv
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSetWriteDeadline(t *testing.T) {
+	s := New(SetErrLogger(nil))
+	s.GET("/slow", func(ctx *Context) Response {
+		extend := ctx.Query("extend") != ""
+		if extend {
+			if err := ctx.SetWriteDeadline(time.Now().Add(time.Second)); err != nil {
+				t.Error(err)
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+		return NewJSONResponse("done")
+	})
+
+	ts := httptest.NewUnstartedServer(s)
+	ts.Config.WriteTimeout = 50 * time.Millisecond
+	ts.Start()
+	defer ts.Close()
+
+	for path, ok := range map[string]bool{"/slow": false, "/slow?extend=1": true} {
+		res, err := http.Get(ts.URL + path)
+		if err == nil {
+			_, err = ioutil.ReadAll(res.Body)
+			res.Body.Close()
+		}
+
+		if (err == nil) != ok {
+			t.Fatalf("%s: expected ok=%v, got %v", path, ok, err)
+		}
+	}
+}
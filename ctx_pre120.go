@@ -0,0 +1,14 @@
+//go:build !go1.20
+// +build !go1.20
+
+package apiserv
+
+import (
+	"net/http"
+	"time"
+)
+
+// SetWriteDeadline requires go1.20+, it always returns http.ErrNotSupported.
+func (ctx *Context) SetWriteDeadline(t time.Time) error {
+	return http.ErrNotSupported
+}
@@ -0,0 +1,45 @@
+package apiserv
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+)
+
+// ClientGone returns true if the client disconnected, either detected by a failed write (broken pipe, connection reset)
+// or by the request's context getting canceled, an exceeded deadline doesn't count (see ctx.TimedOut).
+// Streaming handlers can check it to stop work early.
+func (ctx *Context) ClientGone() bool {
+	if ctx.clientGone {
+		return true
+	}
+
+	if req := ctx.Req; req != nil && errors.Is(req.Context().Err(), context.Canceled) {
+		ctx.clientGone = true
+	}
+
+	return ctx.clientGone
+}
+
+// IsClientDisconnect returns true if err is caused by the client closing the connection,
+// for example write: broken pipe or connection reset by peer.
+func IsClientDisconnect(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, net.ErrClosed) {
+		return true
+	}
+
+	for _, e := range disconnectErrs {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+
+	// some wrappers (ex: tls) lose the underlying errno
+	s := err.Error()
+	return strings.Contains(s, "broken pipe") || strings.Contains(s, "connection reset by peer")
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+// +build !windows
+
+package apiserv
+
+import "syscall"
+
+var disconnectErrs = []error{syscall.EPIPE, syscall.ECONNRESET, syscall.ECONNABORTED}
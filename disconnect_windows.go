@@ -0,0 +1,14 @@
+//go:build windows
+// +build windows
+
+package apiserv
+
+import "syscall"
+
+const (
+	errorNoData     syscall.Errno = 232 // ERROR_NO_DATA, the pipe is being closed
+	wsaeconnaborted syscall.Errno = 10053
+	wsaeconnreset   syscall.Errno = 10054
+)
+
+var disconnectErrs = []error{syscall.ERROR_BROKEN_PIPE, errorNoData, wsaeconnaborted, wsaeconnreset, syscall.EPIPE, syscall.ECONNRESET}
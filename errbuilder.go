@@ -0,0 +1,72 @@
+package apiserv
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// ErrorBuilder builds a list of field errors, see ctx.ValidationError, example:
+//	eb := apiserv.NewErrorBuilder()
+//	if req.Name == "" {
+//		eb.Missing("name")
+//	}
+//	if req.Age < 0 {
+//		eb.Field("age", "must be positive")
+//	}
+//	if r := ctx.ValidationError(eb); r != nil {
+//		return r
+//	}
+type ErrorBuilder struct {
+	errs []*Error
+}
+
+// NewErrorBuilder returns a new empty ErrorBuilder.
+func NewErrorBuilder() *ErrorBuilder {
+	return &ErrorBuilder{}
+}
+
+// Field adds an error for the field.
+func (b *ErrorBuilder) Field(name, message string) *ErrorBuilder {
+	b.errs = append(b.errs, &Error{Message: message, Field: name})
+	return b
+}
+
+// Missing adds a missing field error.
+func (b *ErrorBuilder) Missing(name string) *ErrorBuilder {
+	b.errs = append(b.errs, &Error{Message: "missing field " + strconv.Quote(name), Field: name, IsMissing: true})
+	return b
+}
+
+// Len returns the number of errors.
+func (b *ErrorBuilder) Len() int {
+	return len(b.errs)
+}
+
+// Errors returns the errors added so far.
+func (b *ErrorBuilder) Errors() []*Error {
+	return b.errs
+}
+
+// Err returns the errors as a MultiError, or nil if there aren't any.
+func (b *ErrorBuilder) Err() error {
+	var me MultiError
+	for _, e := range b.errs {
+		me.Push(e)
+	}
+	return me.Err()
+}
+
+// ValidationError returns an error response with the builder's errors, or nil if there aren't any.
+// The status defaults to 422 and can be changed with the ValidationErrorCode option.
+func (ctx *Context) ValidationError(b *ErrorBuilder) Response {
+	if b == nil || len(b.errs) == 0 {
+		return nil
+	}
+
+	code := http.StatusUnprocessableEntity
+	if ctx.s != nil && ctx.s.opts.ValidationErrorCode > 0 {
+		code = ctx.s.opts.ValidationErrorCode
+	}
+
+	return &JSONResponse{Code: code, Errors: b.errs}
+}
@@ -0,0 +1,66 @@
+package apiserv
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// DefaultHTMLErrorTemplate is the template used by the HTMLErrors option if none is passed,
+// it gets executed with an HTMLError.
+var DefaultHTMLErrorTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.Code}} {{.Status}}</title></head>
+<body>
+<h1>{{.Code}} {{.Status}}</h1>
+<ul>
+{{range .Errors}}<li>{{if .Field}}<b>{{.Field}}</b>: {{end}}{{.Message}}</li>
+{{end}}</ul>
+</body>
+</html>
+`))
+
+// HTMLError is the value passed to the html error template, see the HTMLErrors option.
+type HTMLError struct {
+	Code   int
+	Status string
+	Errors []*Error
+}
+
+// wantsHTMLErrors returns true if the HTMLErrors option is set and the client prefers html over json, ex: a browser.
+func (ctx *Context) wantsHTMLErrors() bool {
+	if ctx.s == nil || ctx.s.opts.HTMLErrorTemplate == nil || ctx.Req == nil {
+		return false
+	}
+
+	var htmlQ, jsonQ float64
+	for _, qv := range parseQualityList(ctx.ReqHeader().Get("Accept")) {
+		switch strings.ToLower(qv.value) {
+		case "text/html":
+			htmlQ = qv.q
+		case "application/json":
+			jsonQ = qv.q
+		}
+	}
+
+	return htmlQ > jsonQ
+}
+
+func (ctx *Context) writeHTMLError(code int, errs []*Error) error {
+	var buf bytes.Buffer
+	if err := ctx.s.opts.HTMLErrorTemplate.Execute(&buf, &HTMLError{
+		Code:   code,
+		Status: http.StatusText(code),
+		Errors: errs,
+	}); err != nil {
+		ctx.Logf("html error template: %v", err)
+		return err
+	}
+
+	ctx.done = true
+	ctx.SetContentType(MimeHTML)
+	ctx.WriteHeader(code)
+	_, err := ctx.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,72 @@
+package apiserv
+
+import (
+	"net/http"
+	"strings"
+)
+
+// SetETag sets the response's ETag header, tag gets quoted if it isn't already, weak tags (W/"...") are kept as-is.
+// It should be called before CheckPrecondition.
+func (ctx *Context) SetETag(tag string) {
+	if !strings.HasPrefix(tag, `W/"`) && !strings.HasPrefix(tag, `"`) {
+		tag = `"` + tag + `"`
+	}
+	ctx.Header().Set("ETag", tag)
+}
+
+// CheckPrecondition evaluates the request's If-Match and If-None-Match headers against the ETag set by SetETag,
+// an empty ETag means the resource doesn't exist.
+// If ok is false, the handler should stop and respond with the returned status (412 or 304), example:
+//	ctx.SetETag(user.Version)
+//	if ok, code := ctx.CheckPrecondition(); !ok {
+//		return ctx.Error(code)
+//	}
+// Code is 0 when ok is true.
+func (ctx *Context) CheckPrecondition() (ok bool, code int) {
+	etag := ctx.Header().Get("ETag")
+	h := ctx.Req.Header
+
+	if im := h.Get("If-Match"); im != "" && !etagMatch(im, etag, false) {
+		return false, http.StatusPreconditionFailed
+	}
+
+	if inm := h.Get("If-None-Match"); inm != "" && etagMatch(inm, etag, true) {
+		if m := ctx.Req.Method; m == http.MethodGet || m == http.MethodHead {
+			return false, http.StatusNotModified
+		}
+		return false, http.StatusPreconditionFailed
+	}
+
+	return true, 0
+}
+
+// etagMatch checks if etag matches any of the tags in the header value list,
+// weak uses the weak comparison function (RFC 7232 section 2.3.2), otherwise weak tags never match.
+func etagMatch(list, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+
+	if weak {
+		etag = strings.TrimPrefix(etag, "W/")
+	} else if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+
+	for _, t := range strings.Split(list, ",") {
+		t = strings.TrimSpace(t)
+		if weak {
+			t = strings.TrimPrefix(t, "W/")
+		}
+
+		if t == etag {
+			return true
+		}
+	}
+
+	return false
+}
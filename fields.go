@@ -0,0 +1,57 @@
+package apiserv
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// JSONFiltered is like ctx.JSON, but if the fields query param is set (ex: ?fields=id,name),
+// only the listed top-level fields of v are written, v can be an object or an array of objects.
+// Unknown fields are ignored, other values (ex: strings) are written as-is.
+func (ctx *Context) JSONFiltered(code int, v interface{}) error {
+	fields := ctx.Query("fields")
+	if fields == "" {
+		return ctx.JSON(code, false, v)
+	}
+
+	b, err := JSONMarshal(v)
+	if err != nil {
+		// let ctx.JSON handle the error
+		return ctx.JSON(code, false, v)
+	}
+
+	return ctx.JSON(code, false, filterJSONFields(b, strings.Split(fields, ",")))
+}
+
+func filterJSONFields(b []byte, fields []string) interface{} {
+	keep := make(map[string]struct{}, len(fields))
+	for _, f := range fields {
+		if f = strings.TrimSpace(f); f != "" {
+			keep[f] = struct{}{}
+		}
+	}
+
+	filter := func(m map[string]json.RawMessage) map[string]json.RawMessage {
+		for k := range m {
+			if _, ok := keep[k]; !ok {
+				delete(m, k)
+			}
+		}
+		return m
+	}
+
+	var obj map[string]json.RawMessage
+	if err := JSONUnmarshal(b, &obj); err == nil && obj != nil {
+		return filter(obj)
+	}
+
+	var arr []map[string]json.RawMessage
+	if err := JSONUnmarshal(b, &arr); err == nil {
+		for i, m := range arr {
+			arr[i] = filter(m)
+		}
+		return arr
+	}
+
+	return json.RawMessage(b)
+}
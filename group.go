@@ -1,6 +1,7 @@
 package apiserv
 
 import (
+	"fmt"
 	"net/http"
 	"strings"
 
@@ -27,6 +28,9 @@ type Group interface {
 	// it is NOT safe to call this once you call one of the run functions
 	AddRoute(method, path string, handlers ...Handler) error
 
+	// AddNamedRoute is like AddRoute, but also names the route so its url can be built with Server.URL.
+	AddNamedRoute(name, method, path string, handlers ...Handler) error
+
 	// GET is an alias for AddRoute("GET", path, handlers...).
 	GET(path string, handlers ...Handler) error
 	// PUT is an alias for AddRoute("PUT", path, handlers...).
@@ -65,11 +69,36 @@ func (g *group) Routes() [][3]string {
 // AddRoute adds a handler (or more) to the specific method and path
 // it is NOT safe to call this once you call one of the run functions
 func (g *group) AddRoute(method, path string, handlers ...Handler) error {
-	ghc := groupHandlerChain{
+	ghc := &groupHandlerChain{
 		hc: handlers,
 		g:  g,
 	}
-	return g.s.r.AddRoute(g.nm, method, joinPath(g.path, path), ghc.Serve)
+
+	path = joinPath(g.path, path)
+	ghc.star = router.StarParam(path)
+	if err := g.s.r.AddRoute(g.nm, method, path, ghc.Serve); err != nil {
+		return err
+	}
+
+	g.s.addRouteChain(method, path, ghc)
+	return nil
+}
+
+// AddNamedRoute is like AddRoute, but also names the route so its url can be built with Server.URL, example:
+//	srv.AddNamedRoute("user", "GET", "/users/:id", getUser)
+//	u, err := srv.URL("user", "id", "42") // "/users/42"
+// Names must be unique per server.
+func (g *group) AddNamedRoute(name, method, path string, handlers ...Handler) error {
+	full := joinPath(g.path, path)
+	if err := g.s.checkRouteName(name, full); err != nil {
+		return err
+	}
+
+	// only name the route once it exists
+	if err := g.AddRoute(method, path, handlers...); err != nil {
+		return err
+	}
+	return g.s.nameRoute(name, full)
 }
 
 // GET is an alias for AddRoute("GET", path, handlers...).
@@ -131,8 +160,9 @@ func joinPath(p1, p2 string) string {
 }
 
 type groupHandlerChain struct {
-	g  *group
-	hc []Handler
+	g    *group
+	hc   []Handler
+	star string // the route's catch-all param, see ctx.Wildcard
 }
 
 func (ghc *groupHandlerChain) Serve(rw http.ResponseWriter, req *http.Request, p router.Params) {
@@ -140,17 +170,29 @@ func (ghc *groupHandlerChain) Serve(rw http.ResponseWriter, req *http.Request, p
 		ctx = getCtx(rw, req, p, ghc.g.s)
 
 		mwIdx, hIdx int
+		completed   bool
 	)
-	defer putCtx(ctx)
+
+	ctx.star = ghc.star
+
+	defer func() {
+		// recover here so the panic response goes through the same ctx and the OnResponse hooks see it
+		if !completed && ghc.g.s.catchPanics() {
+			if v := recover(); v != nil {
+				ghc.g.s.handlePanic(ctx, v)
+			}
+		}
+
+		ctx.runOnResponse(!completed)
+		putCtx(ctx)
+	}()
 
 	ctx.next = func() (r Response) {
 		for hIdx < len(ghc.hc) {
 			h := ghc.hc[hIdx]
 			hIdx++
 			if r = h(ctx); r != nil {
-				if !ctx.done && r != Break {
-					r.WriteToCtx(ctx)
-				}
+				ctx.handleResponse(r)
 				break
 			}
 		}
@@ -163,10 +205,7 @@ func (ghc *groupHandlerChain) Serve(rw http.ResponseWriter, req *http.Request, p
 			h := ghc.g.mw[mwIdx]
 			mwIdx++
 			if r = h(ctx); r != nil {
-				if !ctx.done && r != Break {
-					r.WriteToCtx(ctx)
-				}
-
+				ctx.handleResponse(r)
 				break
 			}
 		}
@@ -178,4 +217,25 @@ func (ghc *groupHandlerChain) Serve(rw http.ResponseWriter, req *http.Request, p
 	}
 
 	ctx.Next()
+	completed = true
+}
+
+// handleResponse writes a response returned by a handler,
+// returning a response after the Context is done (ex: calling ctx.JSON then returning RespOK) is most likely a bug,
+// so it gets logged, or panics if the StrictResponses option is set.
+// Once a returned response was written, later ones are assumed to be the same one passed up the chain
+// by middlewares (ex: `return ctx.Next()`), responses can't be compared since they may be uncomparable types.
+func (ctx *Context) handleResponse(r Response) {
+	switch {
+	case r == Break:
+	case !ctx.done:
+		ctx.respWritten = true
+		ctx.writeResponse(r)
+	case !ctx.respWritten:
+		msg := fmt.Sprintf("%T returned after the response was written, it was dropped", r)
+		if ctx.s != nil && ctx.s.opts.StrictResponses {
+			panic(msg)
+		}
+		ctx.Logf("WARNING: %s", msg)
+	}
 }
@@ -0,0 +1,61 @@
+package apiserv
+
+import (
+	"net/http"
+)
+
+// ReadinessPath is the path used by the first call to Server.AddReadinessCheck.
+var ReadinessPath = "/readyz"
+
+type namedCheck struct {
+	name  string
+	check func() error
+}
+
+// AddHealthCheck adds a GET handler on path that responds with 200 and `{"status":"ok"}` as the data if check returns nil,
+// or a 503 error response with the error message otherwise.
+// it is NOT safe to call this once you call one of the run functions
+func (s *Server) AddHealthCheck(path string, check func() error) error {
+	return s.AddRoute(http.MethodGet, path, func(ctx *Context) Response {
+		if err := check(); err != nil {
+			return NewJSONErrorResponse(http.StatusServiceUnavailable, err)
+		}
+
+		return NewJSONResponse(M{"status": "ok"})
+	})
+}
+
+// AddReadinessCheck adds a named check to the readiness endpoint (ReadinessPath),
+// the endpoint responds with 200 if all the checks pass, or a 503 error response with the failed checks' errors otherwise,
+// the data lists the status of each check in both cases.
+// it is NOT safe to call this once you call one of the run functions
+func (s *Server) AddReadinessCheck(name string, check func() error) error {
+	s.readyChecks = append(s.readyChecks, namedCheck{name, check})
+	if len(s.readyChecks) > 1 {
+		return nil
+	}
+
+	return s.AddRoute(http.MethodGet, ReadinessPath, func(ctx *Context) Response {
+		var (
+			checks = make(map[string]string, len(s.readyChecks))
+			errs   []interface{}
+		)
+
+		for _, nc := range s.readyChecks {
+			if err := nc.check(); err != nil {
+				checks[nc.name] = err.Error()
+				errs = append(errs, &Error{Message: err.Error(), Field: nc.name})
+				continue
+			}
+			checks[nc.name] = "ok"
+		}
+
+		if len(errs) > 0 {
+			r := NewJSONErrorResponse(http.StatusServiceUnavailable, errs...)
+			r.Data = M{"status": "error", "checks": checks}
+			return r
+		}
+
+		return NewJSONResponse(M{"status": "ok", "checks": checks})
+	})
+}
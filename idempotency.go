@@ -0,0 +1,204 @@
+package apiserv
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// IdempotencyKeyHeader is the request header read by the Idempotency middleware.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotencyRecord is a recorded response for an idempotency key.
+type IdempotencyRecord struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// IdempotencyStore stores the recorded responses of the Idempotency middleware,
+// implementations must be safe for concurrent use.
+type IdempotencyStore interface {
+	Get(key string) (*IdempotencyRecord, bool)
+	Set(key string, rec *IdempotencyRecord)
+}
+
+// Idempotency is a middleware that records the response of requests with an Idempotency-Key header
+// and replays it for repeated requests with the same key, method and path instead of running the handlers again.
+// Concurrent requests with the same key are serialized, so only the first one runs.
+// GET, HEAD and OPTIONS requests, 5xx and streaming responses are never recorded.
+func Idempotency(store IdempotencyStore) Handler {
+	var kl keyLocker
+	return func(ctx *Context) Response {
+		req := ctx.Req
+		switch req.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return nil
+		}
+
+		key := req.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			return nil
+		}
+		key = req.Method + " " + req.URL.Path + " " + key
+
+		unlock := kl.lock(key)
+		defer unlock()
+
+		if rec, ok := store.Get(key); ok {
+			h := ctx.Header()
+			for k, v := range rec.Header {
+				h[k] = append([]string(nil), v...)
+			}
+			h.Set("Idempotent-Replayed", "true")
+			ctx.WriteHeader(rec.Status)
+			ctx.Write(rec.Body)
+			return Break
+		}
+
+		rw := &recordRW{ResponseWriter: ctx.ResponseWriter}
+		ctx.ResponseWriter = rw
+		ctx.Next()
+		ctx.ResponseWriter = rw.ResponseWriter
+
+		if rw.status == 0 {
+			rw.status = http.StatusOK
+		}
+
+		if !rw.skip && rw.status < http.StatusInternalServerError {
+			store.Set(key, &IdempotencyRecord{
+				Status: rw.status,
+				Header: rw.header,
+				Body:   rw.buf.Bytes(),
+			})
+		}
+
+		return nil
+	}
+}
+
+// recordRW records the response while passing it through to the real writer, used by Idempotency and Cache.
+type recordRW struct {
+	http.ResponseWriter
+	header http.Header
+	buf    bytes.Buffer
+	status int
+	skip   bool
+}
+
+func (w *recordRW) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+		w.header = w.Header().Clone()
+		w.skip = isStreaming(w.header)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recordRW) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if !w.skip {
+		w.buf.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap returns the original ResponseWriter, used by http.ResponseController.
+func (w *recordRW) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *recordRW) Flush() {
+	if hf, ok := w.ResponseWriter.(http.Flusher); ok {
+		hf.Flush()
+	}
+}
+
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// keyLocker serializes access per key.
+type keyLocker struct {
+	mux sync.Mutex
+	m   map[string]*keyLock
+}
+
+func (kl *keyLocker) lock(key string) (unlock func()) {
+	kl.mux.Lock()
+	if kl.m == nil {
+		kl.m = map[string]*keyLock{}
+	}
+	l := kl.m[key]
+	if l == nil {
+		l = &keyLock{}
+		kl.m[key] = l
+	}
+	l.refs++
+	kl.mux.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		kl.mux.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(kl.m, key)
+		}
+		kl.mux.Unlock()
+	}
+}
+
+// NewMemoryIdempotencyStore returns an in-memory IdempotencyStore that keeps records for ttl.
+func NewMemoryIdempotencyStore(ttl time.Duration) IdempotencyStore {
+	return &memIdemStore{
+		m:   map[string]memIdemRecord{},
+		ttl: ttl,
+	}
+}
+
+type memIdemRecord struct {
+	rec     *IdempotencyRecord
+	expires time.Time
+}
+
+type memIdemStore struct {
+	mux       sync.Mutex
+	m         map[string]memIdemRecord
+	ttl       time.Duration
+	lastSweep time.Time
+}
+
+func (s *memIdemStore) Get(key string) (*IdempotencyRecord, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	r, ok := s.m[key]
+	if !ok || time.Now().After(r.expires) {
+		return nil, false
+	}
+	return r.rec, true
+}
+
+func (s *memIdemStore) Set(key string, rec *IdempotencyRecord) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	now := time.Now()
+	// expired records are removed at most once per ttl
+	if now.Sub(s.lastSweep) > s.ttl {
+		for k, r := range s.m {
+			if now.After(r.expires) {
+				delete(s.m, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	s.m[key] = memIdemRecord{rec: rec, expires: now.Add(s.ttl)}
+}
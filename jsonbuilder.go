@@ -0,0 +1,89 @@
+package apiserv
+
+import "net/http"
+
+// JSONResponseBuilder builds a JSONResponse step by step, see ctx.JSONResponse.
+type JSONResponseBuilder struct {
+	ctx    *Context
+	r      JSONResponse
+	header http.Header
+}
+
+// JSONResponse returns a builder for conditionally constructing a response, example:
+//	return ctx.JSONResponse().Status(http.StatusCreated).Data(u).Header("Location", loc).Build()
+// or to write it directly:
+//	err := ctx.JSONResponse().Data(u).Indent(true).Write()
+func (ctx *Context) JSONResponse() *JSONResponseBuilder {
+	return &JSONResponseBuilder{ctx: ctx}
+}
+
+// Status sets the response's status code, if not set it defaults to 200, or 400 if there are errors.
+func (b *JSONResponseBuilder) Status(code int) *JSONResponseBuilder {
+	b.r.Code = code
+	return b
+}
+
+// Data sets the response's data.
+func (b *JSONResponseBuilder) Data(v interface{}) *JSONResponseBuilder {
+	b.r.Data = v
+	return b
+}
+
+// Meta sets the response's metadata.
+func (b *JSONResponseBuilder) Meta(v interface{}) *JSONResponseBuilder {
+	b.r.Meta = v
+	return b
+}
+
+// Errors appends errors to the response, they're handled the same way as NewJSONErrorResponse.
+func (b *JSONResponseBuilder) Errors(errs ...interface{}) *JSONResponseBuilder {
+	for _, err := range errs {
+		b.r.appendErr(err)
+	}
+	return b
+}
+
+// Header adds a response header.
+func (b *JSONResponseBuilder) Header(key, value string) *JSONResponseBuilder {
+	if b.header == nil {
+		b.header = http.Header{}
+	}
+	b.header.Add(key, value)
+	return b
+}
+
+// Indent sets whether the json output is indented.
+func (b *JSONResponseBuilder) Indent(v bool) *JSONResponseBuilder {
+	b.r.Indent = v
+	return b
+}
+
+// Build returns the response, the headers are set when it's written.
+func (b *JSONResponseBuilder) Build() Response {
+	r := b.r
+	if len(b.header) == 0 {
+		return &r
+	}
+	return headerResp{Response: &r, h: b.header}
+}
+
+// Write writes the response to the Context,
+// calling this function marks the Context as done, meaning any returned responses won't be written out.
+func (b *JSONResponseBuilder) Write() error {
+	return b.Build().WriteToCtx(b.ctx)
+}
+
+type headerResp struct {
+	Response
+	h http.Header
+}
+
+func (r headerResp) WriteToCtx(ctx *Context) error {
+	h := ctx.Header()
+	for k, vs := range r.h {
+		for _, v := range vs {
+			h.Add(k, v)
+		}
+	}
+	return r.Response.WriteToCtx(ctx)
+}
@@ -0,0 +1,33 @@
+package apiserv
+
+var jsonpCallbackValidator = IsValidJSONPCallback
+
+// SetJSONPCallbackValidator replaces the func used to validate JSONP callbacks, passing nil resets it to IsValidJSONPCallback.
+// Invalid callbacks are replaced with console.error.
+// It is NOT safe to call once you call one of the run functions.
+func SetJSONPCallbackValidator(fn func(cb string) bool) {
+	if fn == nil {
+		fn = IsValidJSONPCallback
+	}
+	jsonpCallbackValidator = fn
+}
+
+// IsValidJSONPCallback returns true if cb is a safe javascript identifier or property path,
+// matching `^[a-zA-Z_$][\w$.]*$`.
+func IsValidJSONPCallback(cb string) bool {
+	if cb == "" {
+		return false
+	}
+
+	for i := 0; i < len(cb); i++ {
+		c := cb[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == '$':
+		case i > 0 && (c >= '0' && c <= '9' || c == '.'):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
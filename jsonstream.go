@@ -0,0 +1,213 @@
+package apiserv
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// JSONStreamFlushSize is the size of the buffer JSONArrayEncoder keeps before writing to the connection.
+var JSONStreamFlushSize = 32 << 10 // 32kb
+
+var (
+	// ErrStreamClosed is returned when using a closed JSONArrayEncoder.
+	ErrStreamClosed = errors.New("stream is closed")
+
+	// ErrAlreadyDone is returned from ctx.JSONStream if the response was already written.
+	ErrAlreadyDone = errors.New("response was already written")
+
+	// ErrNotJSONArray is returned from ctx.StreamJSONArray if the body isn't a json array.
+	ErrNotJSONArray = errors.New("expected a json array")
+)
+
+// JSONStream returns an encoder that streams a JSONResponse with data being an array,
+// items are buffered and written to the connection every JSONStreamFlushSize bytes, on Flush or on Close.
+// calling this function marks the Context as done, meaning any returned responses won't be written out.
+// The JSONEnvelope option doesn't apply since the data isn't known upfront, streams always use the default envelope.
+//	enc, _ := ctx.JSONStream()
+//	defer enc.Close()
+//	for rows.Next() {
+//		if err := enc.Encode(row); err != nil {
+//			return Break
+//		}
+//	}
+func (ctx *Context) JSONStream() (*JSONArrayEncoder, error) {
+	if ctx.done {
+		return nil, ErrAlreadyDone
+	}
+
+	ctx.done = true
+	ctx.SetContentType(MimeJSON)
+
+	enc := &JSONArrayEncoder{ctx: ctx}
+	enc.buf.WriteString(`{"data":[`)
+	return enc, nil
+}
+
+// JSONArrayEncoder streams items of a JSONResponse's data array, see ctx.JSONStream.
+type JSONArrayEncoder struct {
+	ctx     *Context
+	errs    []*Error
+	buf     bytes.Buffer
+	n       int
+	flushed bool
+	closed  bool
+}
+
+// Encode appends v to the data array.
+func (enc *JSONArrayEncoder) Encode(v interface{}) error {
+	if enc.closed {
+		return ErrStreamClosed
+	}
+
+	b, err := JSONMarshal(v)
+	if err != nil {
+		return err
+	}
+
+	if enc.n > 0 {
+		enc.buf.WriteByte(',')
+	}
+	enc.buf.Write(b)
+	enc.n++
+
+	if enc.buf.Len() >= JSONStreamFlushSize {
+		return enc.Flush()
+	}
+
+	return nil
+}
+
+// AddError adds err to the response's errors array and sets its code to 500,
+// the http status code will only be 500 if nothing was flushed yet.
+func (enc *JSONArrayEncoder) AddError(err error) {
+	if err == nil {
+		return
+	}
+
+	var r JSONResponse
+	r.appendErr(err)
+	enc.errs = append(enc.errs, r.Errors...)
+}
+
+// Flush writes the buffered data to the connection.
+func (enc *JSONArrayEncoder) Flush() (err error) {
+	if enc.closed {
+		return ErrStreamClosed
+	}
+
+	if !enc.flushed {
+		enc.flushed = true
+		enc.ctx.WriteHeader(http.StatusOK)
+	}
+
+	if _, err = enc.ctx.Write(enc.buf.Bytes()); err != nil {
+		return
+	}
+	enc.buf.Reset()
+	enc.ctx.Flush()
+
+	return
+}
+
+// Close closes the data array, writes the errors, code and success fields and flushes the response.
+func (enc *JSONArrayEncoder) Close() error {
+	if enc.closed {
+		return ErrStreamClosed
+	}
+
+	code := http.StatusOK
+	enc.buf.WriteByte(']')
+
+	if len(enc.errs) > 0 {
+		code = http.StatusInternalServerError
+
+		b, err := JSONMarshal(enc.errs)
+		if err != nil {
+			return err
+		}
+		enc.buf.WriteString(`,"errors":`)
+		enc.buf.Write(b)
+	}
+
+	enc.buf.WriteString(`,"code":` + strconv.Itoa(code) + `,"success":` + strconv.FormatBool(code == http.StatusOK) + "}\n")
+
+	if !enc.flushed {
+		enc.flushed = true
+		enc.ctx.WriteHeader(code)
+	}
+
+	_, err := enc.ctx.Write(enc.buf.Bytes())
+	enc.buf.Reset()
+	enc.closed = true
+	return err
+}
+
+// StreamJSONArray decodes the request's body as a json array one element at a time, without loading it all in memory,
+// fn is called for every element and can use decode to unmarshal it, returning an error stops the iteration.
+// The body is closed when it returns. Note that it always uses encoding/json, regardless of SetJSONCodec.
+//	err := ctx.StreamJSONArray(func(decode func(v interface{}) error) error {
+//		var u User
+//		if err := decode(&u); err != nil {
+//			return err
+//		}
+//		return db.Insert(&u)
+//	})
+func (ctx *Context) StreamJSONArray(fn func(decode func(v interface{}) error) error) error {
+	return ctx.streamJSON(false, fn)
+}
+
+// StreamNDJSON is like StreamJSONArray, except the body is expected to be newline-delimited json.
+func (ctx *Context) StreamNDJSON(fn func(decode func(v interface{}) error) error) error {
+	return ctx.streamJSON(true, fn)
+}
+
+func (ctx *Context) streamJSON(ndjson bool, fn func(decode func(v interface{}) error) error) error {
+	defer ctx.CloseBody()
+
+	dec := json.NewDecoder(ctx.Req.Body)
+
+	if !ndjson {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return ErrEmptyBody
+		}
+		if err != nil {
+			return err
+		}
+
+		if tok != json.Delim('[') {
+			return ErrNotJSONArray
+		}
+	}
+
+	for dec.More() {
+		var decoded bool
+		decode := func(v interface{}) error {
+			decoded = true
+			return dec.Decode(v)
+		}
+
+		if err := fn(decode); err != nil {
+			return err
+		}
+
+		if !decoded { // skip the element if fn didn't decode it
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !ndjson {
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package apiserv
+
+import (
+	"io/ioutil"
+	"log"
+)
+
+// RequestIDContextKey is the key used by LogRequests to store the request's id.
+const RequestIDContextKey = ":RID:"
+
+// RequestID returns the request's id set by LogRequests, falling back to the X-Request-Id header.
+func (ctx *Context) RequestID() string {
+	if id, ok := ctx.Get(RequestIDContextKey).(string); ok {
+		return id
+	}
+	return ctx.ReqHeader().Get("X-Request-Id")
+}
+
+// Logf logs to the server's logger, prefixed with the request's id, method and path.
+func (ctx *Context) Logf(f string, args ...interface{}) {
+	if ctx.s == nil {
+		return
+	}
+	// the prefix is passed as an arg since the path can contain %
+	ctx.s.logfStack(3, "%s"+f, append([]interface{}{ctx.logPrefix()}, args...)...)
+}
+
+// Logger returns a logger that writes to the server's logger with the same prefix as ctx.Logf,
+// it discards everything if the server doesn't have a logger.
+func (ctx *Context) Logger() *log.Logger {
+	if ctx.s == nil || ctx.s.opts.Logger == nil {
+		return log.New(ioutil.Discard, "", 0)
+	}
+
+	lg := ctx.s.opts.Logger
+	return log.New(lg.Writer(), lg.Prefix()+ctx.logPrefix(), lg.Flags())
+}
+
+func (ctx *Context) logPrefix() string {
+	p := "[" + ctx.Req.Method + " " + ctx.Req.URL.Path + "] "
+	if id := ctx.RequestID(); id != "" {
+		p = "[reqID:" + id + "] " + p
+	}
+	return p
+}
+
+// AddError records a non-fatal error for the request, for example a failed cache write,
+// they can be read with ctx.Errors or logged by the ErrorCollector middleware. nil errors are ignored.
+func (ctx *Context) AddError(err error) {
+	if err != nil {
+		ctx.errs = append(ctx.errs, err)
+	}
+}
+
+// Errors returns the errors recorded with ctx.AddError.
+func (ctx *Context) Errors() []error {
+	return ctx.errs
+}
+
+// ErrorCollector is a middleware that logs the errors recorded with ctx.AddError once the chain is done.
+func ErrorCollector() Handler {
+	return func(ctx *Context) Response {
+		ctx.Next()
+
+		for i, err := range ctx.errs {
+			ctx.Logf("error %d/%d: %v", i+1, len(ctx.errs), err)
+		}
+
+		return nil
+	}
+}
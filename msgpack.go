@@ -0,0 +1,79 @@
+package apiserv
+
+import (
+	"errors"
+	"net/http"
+)
+
+// MsgpackMarshal is used by ctx.Msgpack and MsgpackResponse, it is nil by default to keep the dependency optional.
+// If set, JSONResponse will also use it for clients that send `Accept: application/msgpack`.
+// Example: apiserv.MsgpackMarshal = msgpack.Marshal
+var MsgpackMarshal func(v interface{}) ([]byte, error)
+
+// ErrNoMsgpackCodec is returned from ctx.Msgpack if MsgpackMarshal isn't set.
+var ErrNoMsgpackCodec = errors.New("apiserv.MsgpackMarshal is not set")
+
+// Msgpack outputs a msgpack encoded object, it is highly recommended to return *MsgpackResponse rather than use this directly.
+// calling this function marks the Context as done, meaning any returned responses won't be written out.
+func (ctx *Context) Msgpack(code int, v interface{}) error {
+	if MsgpackMarshal == nil {
+		return ErrNoMsgpackCodec
+	}
+
+	b, err := MsgpackMarshal(v)
+	if err != nil {
+		return err
+	}
+
+	ctx.done = true
+	ctx.SetContentType(MimeMsgpack)
+
+	if code > 0 {
+		ctx.WriteHeader(code)
+	}
+
+	_, err = ctx.Write(b)
+	return err
+}
+
+// NewMsgpackResponse returns a new success response (code 200) with the specific data
+func NewMsgpackResponse(data interface{}) *MsgpackResponse {
+	return &MsgpackResponse{
+		Code: http.StatusOK,
+		Data: data,
+	}
+}
+
+// MsgpackResponse is the msgpack version of JSONResponse.
+type MsgpackResponse struct {
+	Data    interface{} `json:"data,omitempty" msgpack:"data,omitempty"`
+	Meta    interface{} `json:"meta,omitempty" msgpack:"meta,omitempty"`
+	Errors  []*Error    `json:"errors,omitempty" msgpack:"errors,omitempty"`
+	Code    int         `json:"code" msgpack:"code"`
+	Success bool        `json:"success" msgpack:"success"`
+	Indent  bool        `json:"-" msgpack:"-"`
+}
+
+// WriteToCtx writes the response to a ResponseWriter
+func (r *MsgpackResponse) WriteToCtx(ctx *Context) error {
+	switch r.Code {
+	case 0:
+		if len(r.Errors) > 0 {
+			r.Code = http.StatusBadRequest
+		} else {
+			r.Code = http.StatusOK
+		}
+
+	case http.StatusNoContent: // special case
+		ctx.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	r.Success = r.Code >= http.StatusOK && r.Code < http.StatusBadRequest
+
+	return ctx.Msgpack(r.Code, r)
+}
+
+func acceptsMsgpack(accept string) bool {
+	return prefersMime(accept, MimeMsgpack, "application/x-msgpack")
+}
@@ -5,7 +5,11 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -26,6 +30,8 @@ func LogRequests(logJSONRequests bool) Handler {
 			extra string
 		)
 
+		ctx.Set(RequestIDContextKey, fmt.Sprintf("%05d", id))
+
 		if logJSONRequests {
 			switch m := req.Method; m {
 			case http.MethodPost, http.MethodPut, http.MethodDelete:
@@ -66,6 +72,140 @@ func LogRequests(logJSONRequests bool) Handler {
 	}
 }
 
+// LangContextKey is the key used by the Localization middleware to store the request's language.
+const LangContextKey = "lang"
+
+// Localization is a middleware that sets the request's preferred language (see ctx.PreferredLanguage) in the context,
+// it can be retrieved with ctx.Get(LangContextKey).(string).
+func Localization(supported []string) Handler {
+	return func(ctx *Context) Response {
+		ctx.Set(LangContextKey, ctx.PreferredLanguage(supported))
+		return nil
+	}
+}
+
+// RequireContentType is a middleware that only allows requests with one of the specified content-types (ignoring params like charset),
+// otherwise it returns a 415 error response and breaks the chain.
+// Bodyless requests (GET, HEAD, DELETE, OPTIONS or an empty body) are always allowed.
+func RequireContentType(types ...string) Handler {
+	allowed := make([]string, 0, len(types))
+	for _, t := range types {
+		if mt, _, err := mime.ParseMediaType(t); err == nil {
+			allowed = append(allowed, mt)
+		}
+	}
+
+	return func(ctx *Context) Response {
+		req := ctx.Req
+		switch req.Method {
+		case http.MethodGet, http.MethodHead, http.MethodDelete, http.MethodOptions:
+			return nil
+		}
+
+		if req.ContentLength == 0 || req.Body == nil || req.Body == http.NoBody {
+			return nil
+		}
+
+		ct := ctx.ContentType()
+		if mt, _, err := mime.ParseMediaType(ct); err == nil {
+			for _, t := range allowed {
+				if mt == t {
+					return nil
+				}
+			}
+		}
+
+		return NewJSONErrorResponse(http.StatusUnsupportedMediaType, "unsupported content-type: "+strconv.Quote(ct))
+	}
+}
+
+// Maintenance is a middleware that short-circuits all requests with RespUnavailable(retryAfter) while enabled is set to 1,
+// the flag can be toggled at any time with atomic.StoreInt32.
+// Requests to allowedPaths (ex: health checks) are always passed through.
+func Maintenance(enabled *int32, retryAfter time.Duration, allowedPaths ...string) Handler {
+	allowed := make(map[string]struct{}, len(allowedPaths))
+	for _, p := range allowedPaths {
+		allowed[p] = struct{}{}
+	}
+
+	resp := RespUnavailable(retryAfter)
+	return func(ctx *Context) Response {
+		if atomic.LoadInt32(enabled) == 0 {
+			return nil
+		}
+
+		if _, ok := allowed[ctx.Path()]; ok {
+			return nil
+		}
+
+		return resp
+	}
+}
+
+// HTTPSOptions controls the ForceHTTPS middleware.
+type HTTPSOptions struct {
+	// Host overrides the host used in the redirect url, defaults to the request's host without the port.
+	Host string
+
+	// HSTSMaxAge if > 0, sets the Strict-Transport-Security header on https responses.
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+
+	// ExemptPaths are path prefixes allowed over plain http, ex: /.well-known/acme-challenge/
+	ExemptPaths []string
+}
+
+// ForceHTTPS is a middleware that redirects plain http requests to https, 301 for GET and HEAD and 308 for everything else.
+// Requests are detected as https using ctx.Scheme, so X-Forwarded-Proto is respected for trusted proxies (see the TrustedProxies option).
+func ForceHTTPS(opts HTTPSOptions) Handler {
+	var hsts string
+	if opts.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.FormatInt(int64(opts.HSTSMaxAge/time.Second), 10)
+		if opts.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if opts.HSTSPreload {
+			hsts += "; preload"
+		}
+	}
+
+	return func(ctx *Context) Response {
+		if ctx.Scheme() == "https" {
+			if hsts != "" {
+				ctx.Header().Set("Strict-Transport-Security", hsts)
+			}
+			return nil
+		}
+
+		p := ctx.Path()
+		for _, ep := range opts.ExemptPaths {
+			if strings.HasPrefix(p, ep) {
+				return nil
+			}
+		}
+
+		host := opts.Host
+		if host == "" {
+			host = strings.TrimPrefix(ctx.BaseURL(), "http://")
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				if host = h; strings.Contains(h, ":") { // ipv6
+					host = "[" + h + "]"
+				}
+			}
+		}
+
+		code := http.StatusPermanentRedirect
+		switch ctx.Req.Method {
+		case http.MethodGet, http.MethodHead:
+			code = http.StatusMovedPermanently
+		}
+
+		http.Redirect(ctx, ctx.Req, "https://"+host+ctx.Req.URL.RequestURI(), code)
+		return Break
+	}
+}
+
 const secureCookieKey = ":SC:"
 
 // SecureCookie is a middleware to enable SecureCookies.
@@ -1,7 +1,12 @@
 package apiserv
 
 import (
+	"html/template"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/missionMeteora/apiserv/router"
@@ -9,14 +14,78 @@ import (
 
 // Options allows finer control over the apiserv
 type Options struct {
-	Logger          *log.Logger
-	RouterOptions   *router.Options
-	ReadTimeout     time.Duration
-	WriteTimeout    time.Duration
-	KeepAlivePeriod time.Duration
-	MaxHeaderBytes  int
+	Logger            *log.Logger
+	RouterOptions     *router.Options
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	KeepAlivePeriod   time.Duration
+	MaxHeaderBytes    int
+
+	// MaxURILength if > 0, requests with a longer request uri get rejected with a 414 before any handlers run.
+	MaxURILength int
+
+	// JSONEnvelope if set, is used by JSONResponse to build the value that gets written instead of the default
+	// {data, meta, errors, code, success} envelope, it doesn't apply to ctx.JSONStream.
+	JSONEnvelope JSONEnvelopeFunc
+
+	// NotFoundHandler is called when no route matches the request, it runs after the global middlewares.
+	// It's ignored if the deprecated Server.NotFoundHandler field is set.
+	NotFoundHandler Handler
+
+	// MethodNotAllowedHandler is called when a path exists but not for the request's method,
+	// the Allow header is already set when it gets called.
+	MethodNotAllowedHandler Handler
+
+	// ConnState if set, is used as the underlying http.Server.ConnState, see the ConnState option.
+	ConnState func(net.Conn, http.ConnState)
+
+	// CheckContinue if set, is called for requests with an "Expect: 100-continue" header before any handlers run,
+	// see the CheckContinue option.
+	CheckContinue func(req *http.Request) bool
+
+	// HTMLErrorTemplate if set, is used to render error responses for clients that prefer html, see the HTMLErrors option.
+	HTMLErrorTemplate *template.Template
+
+	// PropagateContextValues makes ctx.Set also store values in the request's context, see the PropagateContextValues option.
+	PropagateContextValues bool
+
+	// BufferJSONResponses makes ctx.JSON set the Content-Length header, see the BufferJSONResponses option.
+	BufferJSONResponses bool
+
+	// StrictResponses makes returning a response after the Context is done panic instead of logging a warning.
+	StrictResponses bool
+
+	// ValidationErrorCode is the status used by ctx.ValidationError, defaults to 422.
+	ValidationErrorCode int
+
+	// PanicResponse if set, builds the response written when a handler panics, see the PanicResponse option.
+	PanicResponse PanicResponseFunc
+
+	// ShutdownSignals are the signals that trigger a graceful shutdown in RunWithGracefulShutdown.
+	ShutdownSignals []os.Signal
+
+	// ShutdownGracePeriod if set, is the max time Shutdown waits before closing the remaining connections,
+	// see the ShutdownGracePeriod option for how it interacts with ShutdownTimeout.
+	ShutdownGracePeriod time.Duration
+
+	// ShutdownTimeout is how long RunContext waits for active connections once its context is canceled, 0 waits forever.
+	ShutdownTimeout time.Duration
+
+	// TrustedProxies are the networks allowed to set the X-Forwarded-Proto and X-Forwarded-Host headers,
+	// see ctx.BaseURL.
+	TrustedProxies []*net.IPNet
+
+	// ResponseTap if set, gets called with a copy of every response, see the ResponseTap option.
+	ResponseTap ResponseTapFunc
+	// ResponseTapMaxBody caps the body passed to ResponseTap, defaults to DefaultResponseTapMaxBody.
+	ResponseTapMaxBody int
 }
 
+// JSONEnvelopeFunc returns the value to be written by JSONResponse, see the JSONEnvelope option.
+// r's Code and Success are already set, it may be shared (ex: RespOK) so it must not be modified.
+type JSONEnvelopeFunc func(r *JSONResponse) interface{}
+
 // Option is a func to set internal server Options.
 type Option interface {
 	apply(opt *Options)
@@ -36,6 +105,16 @@ func ReadTimeout(v time.Duration) Option {
 	})
 }
 
+// ReadHeaderTimeout sets the amount of time allowed to read request headers, independently from the body.
+// It is recommended to use a short ReadHeaderTimeout to protect against slow header attacks,
+// and a longer (or no) ReadTimeout for endpoints that legitimately read large bodies slowly.
+// see http.Server.ReadHeaderTimeout
+func ReadHeaderTimeout(v time.Duration) Option {
+	return optionSetter(func(opt *Options) {
+		opt.ReadHeaderTimeout = v
+	})
+}
+
 // WriteTimeout sets the write timeout on the server.
 // see http.Server.WriteTimeout
 func WriteTimeout(v time.Duration) Option {
@@ -52,6 +131,14 @@ func MaxHeaderBytes(v int) Option {
 	})
 }
 
+// MaxURILength sets the max length of the request uri (path + query), longer requests get a 414 response.
+// Defaults to 0 (disabled), complements MaxHeaderBytes.
+func MaxURILength(n int) Option {
+	return optionSetter(func(opt *Options) {
+		opt.MaxURILength = n
+	})
+}
+
 // SetErrLogger sets the error logger on the server.
 func SetErrLogger(v *log.Logger) Option {
 	return optionSetter(func(opt *Options) {
@@ -61,7 +148,7 @@ func SetErrLogger(v *log.Logger) Option {
 
 // SetKeepAlivePeriod sets the underlying socket's keepalive period,
 // set to -1 to disable socket keepalive.
-// Not to be confused with http keep-alives which is controlled by apiserv.SetKeepAlivesEnabled.
+// Not to be confused with http keep-alives which is controlled by Server.SetKeepAlivesEnabled.
 func SetKeepAlivePeriod(p time.Duration) Option {
 	return optionSetter(func(opt *Options) {
 		opt.KeepAlivePeriod = p
@@ -84,3 +171,230 @@ func SetNoCatchPanics(enable bool) Option {
 		opt.RouterOptions.NoCatchPanics = enable
 	})
 }
+
+// SetShutdownSignals sets the signals that RunWithGracefulShutdown listens for,
+// defaults to os.Interrupt and syscall.SIGTERM.
+func SetShutdownSignals(sigs ...os.Signal) Option {
+	return optionSetter(func(opt *Options) {
+		opt.ShutdownSignals = sigs
+	})
+}
+
+// ShutdownTimeout sets how long RunContext waits for active connections once its context is canceled,
+// defaults to 30 seconds, 0 waits forever.
+func ShutdownTimeout(v time.Duration) Option {
+	return optionSetter(func(opt *Options) {
+		opt.ShutdownTimeout = v
+	})
+}
+
+// ShutdownGracePeriod makes Shutdown (and RunWithGracefulShutdown / RunContext) forcibly close connections
+// that are still active after d, for example stuck long-polls, Shutdown returns ErrForcedShutdown when that happens.
+// If Shutdown gets a timeout as well (ex: RunContext passes ShutdownTimeout), the shorter of the two is used,
+// unlike the grace period, an expired timeout alone leaves the remaining connections open.
+func ShutdownGracePeriod(d time.Duration) Option {
+	return optionSetter(func(opt *Options) {
+		opt.ShutdownGracePeriod = d
+	})
+}
+
+// RedirectTrailingSlash toggles redirecting /path/ to /path (and vice versa) if only the other one has a handler.
+// see router.Options.RedirectTrailingSlash
+func RedirectTrailingSlash(enable bool) Option {
+	return optionSetter(func(opt *Options) {
+		if opt.RouterOptions == nil {
+			opt.RouterOptions = &router.Options{}
+		}
+		opt.RouterOptions.RedirectTrailingSlash = enable
+	})
+}
+
+// RedirectFixedPath toggles redirecting to the cleaned up path rather than silently rewriting it.
+// see router.Options.RedirectFixedPath
+func RedirectFixedPath(enable bool) Option {
+	return optionSetter(func(opt *Options) {
+		if opt.RouterOptions == nil {
+			opt.RouterOptions = &router.Options{}
+		}
+		opt.RouterOptions.RedirectFixedPath = enable
+	})
+}
+
+// AutoOptions toggles automatically answering OPTIONS requests with a 204 and an Allow header listing the path's methods,
+// explicitly registered OPTIONS handlers (ex: AllowCORS) take precedence.
+// The response is written by the router, so middlewares don't run for it.
+// see router.Options.AutoOptions
+func AutoOptions(enable bool) Option {
+	return optionSetter(func(opt *Options) {
+		if opt.RouterOptions == nil {
+			opt.RouterOptions = &router.Options{}
+		}
+		opt.RouterOptions.AutoOptions = enable
+	})
+}
+
+// CaseInsensitive makes routing ignore the ASCII case of the static parts of routes (ex: /Users/123 matches /users/:id),
+// param values keep their original case. It costs a lowercased copy of the path per request.
+// If exemptStars is true, routes ending with a *param (ex: Static) still require an exact prefix match.
+// see router.Options.CaseInsensitive
+func CaseInsensitive(enable, exemptStars bool) Option {
+	return optionSetter(func(opt *Options) {
+		if opt.RouterOptions == nil {
+			opt.RouterOptions = &router.Options{}
+		}
+		opt.RouterOptions.CaseInsensitive = enable
+		opt.RouterOptions.CaseSensitiveStars = exemptStars
+	})
+}
+
+// CleanPath controls how requests with unclean paths (ex: /a//b/../c) are handled, by default they're rewritten in place.
+// If redirect is true, GET and HEAD requests are redirected (301) to the clean path, and other methods are rewritten in place.
+// It applies before routing, so catch-all params (ex: Static's *fp) always get the clean path.
+func CleanPath(redirect bool) Option {
+	return optionSetter(func(opt *Options) {
+		if opt.RouterOptions == nil {
+			opt.RouterOptions = &router.Options{}
+		}
+		ro := opt.RouterOptions
+		ro.NoAutoCleanURL = false
+		ro.RedirectFixedPath, ro.RedirectFixedPathOnlyGET = redirect, redirect
+	})
+}
+
+// TrustedProxies sets the proxies allowed to set the X-Forwarded-Proto and X-Forwarded-Host headers,
+// each entry can be an ip or a cidr (ex: "10.0.0.0/8"), it panics on invalid entries.
+// By default no proxies are trusted.
+func TrustedProxies(cidrs ...string) Option {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		if !strings.Contains(c, "/") {
+			if ip := net.ParseIP(c); ip != nil && ip.To4() != nil {
+				c += "/32"
+			} else {
+				c += "/128"
+			}
+		}
+
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic("apiserv: invalid trusted proxy: " + err.Error())
+		}
+		nets = append(nets, n)
+	}
+
+	return optionSetter(func(opt *Options) {
+		opt.TrustedProxies = nets
+	})
+}
+
+// JSONEnvelope sets the func used by JSONResponse to build the value that gets written, example:
+//	JSONEnvelope(func(r *JSONResponse) interface{} {
+//		return M{"result": r.Data, "page": r.Meta, "err": r.Errors}
+//	})
+func JSONEnvelope(fn JSONEnvelopeFunc) Option {
+	return optionSetter(func(opt *Options) {
+		opt.JSONEnvelope = fn
+	})
+}
+
+// NotFoundHandler sets the handler called when no route matches the request,
+// the global middlewares (ex: LogRequests) run before it, defaults to returning RespNotFound.
+// It replaces the deprecated Server.NotFoundHandler field, which takes precedence if set.
+func NotFoundHandler(h Handler) Option {
+	return optionSetter(func(opt *Options) {
+		opt.NotFoundHandler = h
+	})
+}
+
+// MethodNotAllowedHandler sets the handler called when a path exists but not for the request's method,
+// the Allow header is set before calling it, defaults to returning RespMethodNotAllowed.
+func MethodNotAllowedHandler(h Handler) Option {
+	return optionSetter(func(opt *Options) {
+		opt.MethodNotAllowedHandler = h
+	})
+}
+
+// ConnState sets a func that gets called when a client connection changes state (new, active, idle, hijacked or closed),
+// for example to export active connections metrics. See http.Server.ConnState.
+// It runs outside the handler chain and is called synchronously by net/http, so it should be fast.
+func ConnState(fn func(net.Conn, http.ConnState)) Option {
+	return optionSetter(func(opt *Options) {
+		opt.ConnState = fn
+	})
+}
+
+// CheckContinue sets a func that gets called for requests with an "Expect: 100-continue" header before any handlers run,
+// returning false rejects the request with a 417 before the client sends the body (see RespExpectationFailed).
+// net/http only sends the 100 Continue once the body is read, so handlers can also reject early based on the headers
+// (ex: a 413 for a large Content-Length) as long as they don't read the body, see ctx.ExpectsContinue.
+func CheckContinue(fn func(req *http.Request) bool) Option {
+	return optionSetter(func(opt *Options) {
+		opt.CheckContinue = fn
+	})
+}
+
+// HTMLErrors makes JSONResponse errors render as html using tmpl when the client prefers text/html over json (ex: a browser),
+// other clients still get json. tmpl is executed with an *HTMLError, nil uses DefaultHTMLErrorTemplate.
+func HTMLErrors(tmpl *template.Template) Option {
+	if tmpl == nil {
+		tmpl = DefaultHTMLErrorTemplate
+	}
+
+	return optionSetter(func(opt *Options) {
+		opt.HTMLErrorTemplate = tmpl
+	})
+}
+
+// PropagateContextValues makes ctx.Set also store the value in ctx.Req's context.Context under ContextKey(key),
+// so downstream libraries using req.Context().Value(apiserv.ContextKey("key")) can see it.
+// Since ContextKey is its own type, it can't collide with keys of other packages,
+// and ctx.Get prefers values set with ctx.Set over ones already in the request's context.
+// Each ctx.Set replaces ctx.Req with a shallow copy (see http.Request.WithContext).
+func PropagateContextValues(enable bool) Option {
+	return optionSetter(func(opt *Options) {
+		opt.PropagateContextValues = enable
+	})
+}
+
+// BufferJSONResponses makes ctx.JSON (and JSONResponse) set the Content-Length header instead of using a chunked response,
+// for clients and legacy proxies that don't handle chunked json well. Compressed responses are still chunked.
+// ctx.JSON always marshals the whole value before writing it, so this doesn't use more memory, but big responses
+// are fully sent with their length rather than flushed progressively by the http server.
+func BufferJSONResponses(enable bool) Option {
+	return optionSetter(func(opt *Options) {
+		opt.BufferJSONResponses = enable
+	})
+}
+
+// StrictResponses makes handlers that return a response after the Context is already done (ex: calling ctx.JSON then returning RespOK)
+// panic instead of logging a warning, the returned response is never written. Useful in development and tests.
+func StrictResponses(enable bool) Option {
+	return optionSetter(func(opt *Options) {
+		opt.StrictResponses = enable
+	})
+}
+
+// ValidationErrorCode sets the status code used by ctx.ValidationError, defaults to 422 (http.StatusUnprocessableEntity).
+func ValidationErrorCode(code int) Option {
+	return optionSetter(func(opt *Options) {
+		opt.ValidationErrorCode = code
+	})
+}
+
+// PanicResponse sets the func used to build the response written when a handler panics,
+// it gets the request's Context so the response can include request metadata (see PanicResponseWithRequestInfo).
+// Server.PanicHandler takes precedence if set, the default response is a 500 JSON error with the panic's value.
+func PanicResponse(fn PanicResponseFunc) Option {
+	return optionSetter(func(opt *Options) {
+		opt.PanicResponse = fn
+	})
+}
+
+// ResponseTap calls fn after every response with the status and up to maxBody bytes of the written body,
+// meant for debugging, it costs an extra copy of every response so it should only be enabled when needed.
+// Streaming (text/event-stream) and hijacked responses are skipped, maxBody <= 0 uses DefaultResponseTapMaxBody.
+func ResponseTap(fn ResponseTapFunc, maxBody int) Option {
+	return optionSetter(func(opt *Options) {
+		opt.ResponseTap, opt.ResponseTapMaxBody = fn, maxBody
+	})
+}
@@ -0,0 +1,76 @@
+package apiserv
+
+import (
+	"strconv"
+)
+
+// DefaultPaginationLimit is used by ctx.Pagination if defaults.Limit isn't set.
+const DefaultPaginationLimit = 20
+
+// Pagination holds the common list params, see ctx.Pagination.
+type Pagination struct {
+	Page   int    `json:"page"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+	Sort   string `json:"sort,omitempty"`
+
+	// MaxLimit clamps Limit if > 0, it's only used in the defaults passed to ctx.Pagination.
+	MaxLimit int `json:"-"`
+}
+
+// Pagination parses the page, limit, offset and sort query params, missing ones use the values in defaults.
+// limit is clamped to defaults.MaxLimit, if offset is passed it takes precedence over page,
+// otherwise offset is computed from page and limit.
+// Invalid values return a MultiError of *Error with the field names.
+func (ctx *Context) Pagination(defaults Pagination) (p Pagination, err error) {
+	p = defaults
+	if p.Page < 1 {
+		p.Page = 1
+	}
+
+	if p.Limit < 1 {
+		p.Limit = DefaultPaginationLimit
+	}
+
+	q := ctx.Req.URL.Query()
+
+	var me MultiError
+	parse := func(key string, min int, typ string, dst *int) bool {
+		v := q.Get(key)
+		if v == "" {
+			return false
+		}
+
+		n, err := strconv.Atoi(v)
+		if err != nil || n < min {
+			me.Push(invalidParam(key, v, typ))
+			return false
+		}
+
+		*dst = n
+		return true
+	}
+
+	parse("page", 1, "a positive integer", &p.Page)
+	parse("limit", 1, "a positive integer", &p.Limit)
+
+	if p.MaxLimit > 0 && p.Limit > p.MaxLimit {
+		p.Limit = p.MaxLimit
+	}
+
+	if parse("offset", 0, "a non-negative integer", &p.Offset) {
+		p.Page = p.Offset/p.Limit + 1
+	} else {
+		p.Offset = (p.Page - 1) * p.Limit
+	}
+
+	if v := q.Get("sort"); v != "" {
+		p.Sort = v
+	}
+
+	if len(me) > 0 {
+		return p, me
+	}
+
+	return p, nil
+}
@@ -0,0 +1,131 @@
+package apiserv
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// PanicResponseFunc returns the response to write when a handler panics with v, see the PanicResponse option.
+type PanicResponseFunc func(ctx *Context, v interface{}) Response
+
+// PanicResponseWithRequestInfo is a PanicResponseFunc that includes the request id (see ctx.RequestID),
+// method and path in the response's data, for example:
+//	srv := apiserv.New(apiserv.PanicResponse(apiserv.PanicResponseWithRequestInfo))
+func PanicResponseWithRequestInfo(ctx *Context, v interface{}) Response {
+	r := NewJSONErrorResponse(http.StatusInternalServerError, fmt.Sprintf("PANIC (%T): %v", v, v))
+	r.Data = M{
+		"requestID": ctx.RequestID(),
+		"method":    ctx.Req.Method,
+		"path":      ctx.Path(),
+	}
+	return r
+}
+
+// Fallback wraps primary and recovers its panics, onPanic's response is returned instead of the global panic response,
+// for example to serve stale cached data from a non-critical endpoint. The panic is still logged.
+// Note that it can't replace a response primary already started writing.
+func Fallback(primary Handler, onPanic func(ctx *Context, v interface{}) Response) Handler {
+	return func(ctx *Context) (r Response) {
+		defer func() {
+			if v := recover(); v != nil {
+				ctx.Logf("PANIC (%T): %v", v, v)
+				r = onPanic(ctx, v)
+			}
+		}()
+
+		return primary(ctx)
+	}
+}
+
+// PanicMapper maps a recovered panic value to a status and response, returning false if it doesn't handle v.
+// If the response is nil, a JSON error response with the status is used.
+type PanicMapper func(v interface{}) (int, Response, bool)
+
+var (
+	panicMappersMux sync.RWMutex
+	panicMappers    []PanicMapper
+)
+
+// RegisterPanicMapper registers a func consulted when a handler panics, before the PanicResponse option and Server.PanicHandler,
+// mappers are called in the order they were registered and the first one to claim the panic is used, for example:
+//	type NotFoundPanic string
+//	apiserv.RegisterPanicMapper(func(v interface{}) (int, apiserv.Response, bool) {
+//		if nf, ok := v.(NotFoundPanic); ok {
+//			return http.StatusNotFound, apiserv.NewJSONErrorResponse(http.StatusNotFound, string(nf)), true
+//		}
+//		return 0, nil, false
+//	})
+// Claimed panics are treated as control flow and aren't logged.
+func RegisterPanicMapper(fn PanicMapper) {
+	if fn == nil {
+		return
+	}
+
+	panicMappersMux.Lock()
+	defer panicMappersMux.Unlock()
+	panicMappers = append(panicMappers, fn)
+}
+
+func mapPanic(v interface{}) (int, Response, bool) {
+	panicMappersMux.RLock()
+	defer panicMappersMux.RUnlock()
+
+	for _, fn := range panicMappers {
+		if code, r, ok := fn(v); ok {
+			return code, r, true
+		}
+	}
+
+	return 0, nil, false
+}
+
+func (s *Server) catchPanics() bool {
+	ro := s.opts.RouterOptions
+	return ro == nil || !ro.NoCatchPanics
+}
+
+func (s *Server) handlePanic(ctx *Context, v interface{}) {
+	if code, r, ok := mapPanic(v); ok {
+		// the handler already started writing the response, nothing we can do
+		if ctx.done || ctx.status != 0 {
+			return
+		}
+
+		if r == nil {
+			r = NewJSONErrorResponse(code)
+		} else if code > 0 {
+			ctx.SetStatus(code)
+		}
+
+		if r != Break {
+			r.WriteToCtx(ctx)
+		}
+		return
+	}
+
+	s.Logf("PANIC (%T): %v", v, v)
+
+	if h := s.PanicHandler; h != nil {
+		h(ctx, v)
+		return
+	}
+
+	// the handler already started writing the response, nothing we can do
+	if ctx.done || ctx.status != 0 {
+		return
+	}
+
+	var r Response
+	if fn := s.opts.PanicResponse; fn != nil {
+		r = fn(ctx, v)
+	}
+
+	if r == nil {
+		r = NewJSONErrorResponse(http.StatusInternalServerError, fmt.Sprintf("PANIC (%T): %v", v, v))
+	}
+
+	if r != Break {
+		r.WriteToCtx(ctx)
+	}
+}
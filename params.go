@@ -0,0 +1,159 @@
+package apiserv
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ErrPathTraversal is returned from ctx.WildcardPath if the catch-all param tries to escape its root.
+var ErrPathTraversal = errors.New("path traversal is not allowed")
+
+// ParamInt returns the path param key as an int.
+// On failure it returns an *Error with the Field set to key.
+func (ctx *Context) ParamInt(key string) (int, error) {
+	n, err := ctx.ParamInt64(key)
+	return int(n), err
+}
+
+// ParamInt64 returns the path param key as an int64.
+// On failure it returns an *Error with the Field set to key.
+func (ctx *Context) ParamInt64(key string) (int64, error) {
+	v := ctx.Param(key)
+	if v == "" {
+		return 0, missingParam(key)
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, invalidParam(key, v, "an integer")
+	}
+
+	return n, nil
+}
+
+// ParamBool returns the path param key as a bool, accepts the same values as strconv.ParseBool.
+// On failure it returns an *Error with the Field set to key.
+func (ctx *Context) ParamBool(key string) (bool, error) {
+	v := ctx.Param(key)
+	if v == "" {
+		return false, missingParam(key)
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, invalidParam(key, v, "a boolean")
+	}
+
+	return b, nil
+}
+
+// ParamUUID returns the path param key if it is a valid UUID (xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx).
+// On failure it returns an *Error with the Field set to key.
+func (ctx *Context) ParamUUID(key string) (string, error) {
+	v := ctx.Param(key)
+	if v == "" {
+		return "", missingParam(key)
+	}
+
+	if !isUUID(v) {
+		return "", invalidParam(key, v, "a UUID")
+	}
+
+	return v, nil
+}
+
+// Wildcard returns the catch-all param of *param routes (ex: "/static/*fp") without a leading slash,
+// it returns an empty string on routes without one.
+func (ctx *Context) Wildcard() string {
+	if ctx.star == "" {
+		return ""
+	}
+	return strings.TrimLeft(ctx.Params.Get(ctx.star), "/")
+}
+
+// WildcardPath is like Wildcard, but returns a cleaned up path that is safe to join with a local directory
+// or a proxy target, it returns ErrPathTraversal if the param contains any ".." segments.
+func (ctx *Context) WildcardPath() (string, error) {
+	v := ctx.Wildcard()
+	for _, seg := range strings.FieldsFunc(v, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if seg == ".." {
+			return "", ErrPathTraversal
+		}
+	}
+
+	return path.Clean("/" + v)[1:], nil
+}
+
+// MustParamInt is like ParamInt, but returns a 400 error response on failure,
+// like the other MustParam* helpers, the response isn't written, the handler is expected to return it, example:
+//	id, r := ctx.MustParamInt("id")
+//	if r != nil {
+//		return r
+//	}
+func (ctx *Context) MustParamInt(key string) (int, Response) {
+	n, err := ctx.ParamInt(key)
+	if err != nil {
+		return 0, NewJSONErrorResponse(http.StatusBadRequest, err)
+	}
+	return n, nil
+}
+
+// MustParamInt64 is like ParamInt64, but returns a 400 error response on failure.
+func (ctx *Context) MustParamInt64(key string) (int64, Response) {
+	n, err := ctx.ParamInt64(key)
+	if err != nil {
+		return 0, NewJSONErrorResponse(http.StatusBadRequest, err)
+	}
+	return n, nil
+}
+
+// MustParamBool is like ParamBool, but returns a 400 error response on failure.
+func (ctx *Context) MustParamBool(key string) (bool, Response) {
+	b, err := ctx.ParamBool(key)
+	if err != nil {
+		return false, NewJSONErrorResponse(http.StatusBadRequest, err)
+	}
+	return b, nil
+}
+
+// MustParamUUID is like ParamUUID, but returns a 400 error response on failure.
+func (ctx *Context) MustParamUUID(key string) (string, Response) {
+	v, err := ctx.ParamUUID(key)
+	if err != nil {
+		return "", NewJSONErrorResponse(http.StatusBadRequest, err)
+	}
+	return v, nil
+}
+
+func missingParam(key string) *Error {
+	return &Error{Message: "missing param " + strconv.Quote(key), Field: key, IsMissing: true}
+}
+
+func invalidParam(key, v, typ string) *Error {
+	return &Error{Message: "param " + strconv.Quote(key) + " is not " + typ + ": " + strconv.Quote(v), Field: key}
+}
+
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,77 @@
+package apiserv
+
+import (
+	"net/http"
+)
+
+// MimeProblemJSON is the content-type of RFC 7807 problem documents.
+const MimeProblemJSON = "application/problem+json"
+
+// ProblemDetails is an RFC 7807 problem document, it implements Response.
+// Errors is an extension member holding the same errors as JSONResponse, to make migrating clients easier.
+type ProblemDetails struct {
+	Type     string   `json:"type,omitempty"`
+	Title    string   `json:"title,omitempty"`
+	Status   int      `json:"status,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+	Instance string   `json:"instance,omitempty"`
+	Errors   []*Error `json:"errors,omitempty"`
+}
+
+// NewProblemResponse returns a problem document with the specific status and errors,
+// errs accepts the same values as NewJSONErrorResponse, the first error is used as the detail.
+func NewProblemResponse(status int, errs ...interface{}) *ProblemDetails {
+	return NewJSONErrorResponse(status, errs...).Problem()
+}
+
+// Problem converts r to a problem document.
+func (r *JSONResponse) Problem() *ProblemDetails {
+	p := &ProblemDetails{
+		Status: r.Code,
+		Errors: r.Errors,
+	}
+
+	if len(r.Errors) > 0 {
+		p.Detail = r.Errors[0].Message
+	}
+
+	return p
+}
+
+// WriteToCtx writes the problem document to the ctx, if Status is 0 it defaults to 400 if there are errors,
+// otherwise 500. Title defaults to the status text.
+func (p *ProblemDetails) WriteToCtx(ctx *Context) error {
+	return ctx.Problem(p.Status, *p)
+}
+
+// Problem writes p as an application/problem+json response, status overrides p.Status if > 0.
+// calling this function marks the Context as done, meaning any returned responses won't be written out.
+func (ctx *Context) Problem(status int, p ProblemDetails) error {
+	if status > 0 {
+		p.Status = status
+	}
+
+	if p.Status == 0 {
+		if len(p.Errors) > 0 {
+			p.Status = http.StatusBadRequest
+		} else {
+			p.Status = http.StatusInternalServerError
+		}
+	}
+
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+
+	b, err := jsonMarshal(&p, false)
+	if err != nil {
+		ctx.Logf("json error: %v", err)
+		return err
+	}
+
+	ctx.done = true
+	ctx.SetContentType(MimeProblemJSON)
+	ctx.WriteHeader(p.Status)
+	_, err = ctx.Write(append(b, '\n'))
+	return err
+}
@@ -0,0 +1,87 @@
+package apiserv
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// MimeProtobuf is the content-type used by ctx.Proto and ProtoResponse.
+const MimeProtobuf = "application/x-protobuf"
+
+// ProtoMarshal is used by ctx.Proto and ProtoResponse, it is nil by default to keep the protobuf dependency optional,
+// importing the github.com/missionMeteora/apiserv/protoresp module sets it and adds typed proto.Message helpers.
+// If set, JSONResponse will also use it to encode the data of successful responses for clients that send `Accept: application/x-protobuf`,
+// falling back to json if it fails (ex: the data isn't a proto.Message), example:
+//	apiserv.ProtoMarshal = func(v interface{}) ([]byte, error) {
+//		if m, ok := v.(proto.Message); ok {
+//			return proto.Marshal(m)
+//		}
+//		return nil, fmt.Errorf("%T is not a proto.Message", v)
+//	}
+var ProtoMarshal func(v interface{}) ([]byte, error)
+
+// ErrNoProtoCodec is returned from ctx.Proto if ProtoMarshal isn't set.
+var ErrNoProtoCodec = errors.New("apiserv.ProtoMarshal is not set")
+
+// Proto outputs a protobuf encoded message, it is highly recommended to return *ProtoResponse rather than use this directly.
+// calling this function marks the Context as done, meaning any returned responses won't be written out.
+func (ctx *Context) Proto(code int, msg interface{}) error {
+	if ProtoMarshal == nil {
+		return ErrNoProtoCodec
+	}
+
+	b, err := ProtoMarshal(msg)
+	if err != nil {
+		return err
+	}
+
+	ctx.writeProto(code, b)
+	return nil
+}
+
+func (ctx *Context) writeProto(code int, b []byte) {
+	ctx.done = true
+	ctx.SetContentType(MimeProtobuf)
+	if h := ctx.Header(); h.Get(encodingHeader) == "" {
+		h.Set("Content-Length", strconv.Itoa(len(b)))
+	}
+
+	if code > 0 {
+		ctx.WriteHeader(code)
+	}
+
+	ctx.Write(b)
+}
+
+// NewProtoResponse returns a new success response (code 200) with the specific message.
+func NewProtoResponse(msg interface{}) *ProtoResponse {
+	return &ProtoResponse{
+		Code: http.StatusOK,
+		Msg:  msg,
+	}
+}
+
+// ProtoResponse is a response that writes a protobuf message, see ProtoMarshal.
+type ProtoResponse struct {
+	Code int
+	Msg  interface{}
+}
+
+// WriteToCtx writes the response to a ResponseWriter
+func (r *ProtoResponse) WriteToCtx(ctx *Context) error {
+	code := r.Code
+	if code == 0 {
+		code = http.StatusOK
+	}
+
+	if err := ctx.Proto(code, r.Msg); err != nil {
+		return NewJSONErrorResponse(http.StatusInternalServerError, err).WriteToCtx(ctx)
+	}
+
+	return nil
+}
+
+func acceptsProto(accept string) bool {
+	return prefersMime(accept, MimeProtobuf, "application/protobuf")
+}
@@ -0,0 +1,23 @@
+module github.com/missionMeteora/apiserv/protoresp
+
+go 1.17
+
+require (
+	github.com/missionMeteora/apiserv v0.0.0
+	google.golang.org/protobuf v1.28.1
+)
+
+require (
+	github.com/andybalholm/brotli v1.0.4 // indirect
+	github.com/gorilla/securecookie v1.1.1 // indirect
+	github.com/klauspost/compress v1.14.1 // indirect
+	github.com/missionMeteora/toolkit v0.0.0-20170713173850-88364e3ef8cc // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	github.com/valyala/fasthttp v1.32.0 // indirect
+	go.oneofone.dev/otk v1.0.1 // indirect
+	golang.org/x/crypto v0.0.0-20211215153901-e495a2d5b3d3 // indirect
+	golang.org/x/net v0.0.0-20220111093109-d55c255bac03 // indirect
+	golang.org/x/text v0.3.7 // indirect
+)
+
+replace github.com/missionMeteora/apiserv => ../
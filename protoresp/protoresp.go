@@ -0,0 +1,40 @@
+// Package protoresp registers google.golang.org/protobuf as apiserv's protobuf codec and provides typed helpers,
+// it's a separate module so apiserv itself doesn't depend on protobuf, importing it is enough to enable the codec:
+//	import _ "github.com/missionMeteora/apiserv/protoresp"
+package protoresp
+
+import (
+	"fmt"
+
+	"github.com/missionMeteora/apiserv"
+	"google.golang.org/protobuf/proto"
+)
+
+func init() {
+	apiserv.ProtoMarshal = Marshal
+}
+
+// Marshal is the apiserv.ProtoMarshal implementation, it returns an error if v isn't a proto.Message,
+// which makes JSONResponse fall back to json.
+func Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protoresp: %T is not a proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+// New returns a new success response (code 200) with the specific message.
+func New(msg proto.Message) *apiserv.ProtoResponse {
+	return apiserv.NewProtoResponse(msg)
+}
+
+// NewWithCode is like New, but with a custom status code.
+func NewWithCode(code int, msg proto.Message) *apiserv.ProtoResponse {
+	return &apiserv.ProtoResponse{Code: code, Msg: msg}
+}
+
+// Write is a typed version of ctx.Proto, it marks the Context as done.
+func Write(ctx *apiserv.Context, code int, msg proto.Message) error {
+	return ctx.Proto(code, msg)
+}
@@ -0,0 +1,42 @@
+package protoresp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/missionMeteora/apiserv"
+	"github.com/missionMeteora/apiserv/protoresp"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestProtoResp(t *testing.T) {
+	srv := apiserv.New(apiserv.SetErrLogger(nil))
+	srv.GET("/msg", func(ctx *apiserv.Context) apiserv.Response {
+		return protoresp.New(wrapperspb.String("x"))
+	})
+	srv.GET("/json", func(ctx *apiserv.Context) apiserv.Response {
+		return apiserv.NewJSONResponse(wrapperspb.String("y"))
+	})
+
+	for path, exp := range map[string]string{"/msg": "x", "/json": "y"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept", apiserv.MimeProtobuf)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+
+		var m wrapperspb.StringValue
+		if err := proto.Unmarshal(w.Body.Bytes(), &m); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+
+		if ct := w.Header().Get("Content-Type"); ct != apiserv.MimeProtobuf || m.Value != exp {
+			t.Fatalf("%s: unexpected response (%s): %v", path, ct, m.Value)
+		}
+	}
+
+	if _, err := protoresp.Marshal("not a message"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
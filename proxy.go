@@ -0,0 +1,75 @@
+package apiserv
+
+import (
+	"net"
+	"strings"
+)
+
+// FromTrustedProxy returns true if the request's remote address is one of the server's TrustedProxies.
+func (ctx *Context) FromTrustedProxy() bool {
+	if ctx.s == nil || len(ctx.s.opts.TrustedProxies) == 0 {
+		return false
+	}
+
+	host, _, err := net.SplitHostPort(ctx.Req.RemoteAddr)
+	if err != nil {
+		host = ctx.Req.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, n := range ctx.s.opts.TrustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Scheme returns the request's scheme (http or https), respecting X-Forwarded-Proto if the request is from a trusted proxy.
+func (ctx *Context) Scheme() string {
+	if ctx.FromTrustedProxy() {
+		switch p := strings.ToLower(firstHeaderValue(ctx.Req.Header.Get("X-Forwarded-Proto"))); p {
+		case "http", "https":
+			return p
+		}
+	}
+
+	if ctx.Req.TLS != nil {
+		return "https"
+	}
+
+	return "http"
+}
+
+// BaseURL returns the request's scheme and host (ex: https://example.com),
+// respecting X-Forwarded-Proto and X-Forwarded-Host if the request is from a trusted proxy (see the TrustedProxies option).
+func (ctx *Context) BaseURL() string {
+	host := ctx.Req.Host
+	if ctx.FromTrustedProxy() {
+		if h := firstHeaderValue(ctx.Req.Header.Get("X-Forwarded-Host")); h != "" {
+			host = h
+		}
+	}
+
+	return ctx.Scheme() + "://" + host
+}
+
+// AbsoluteURL returns path prefixed with ctx.BaseURL(), useful for Location headers and links.
+func (ctx *Context) AbsoluteURL(path string) string {
+	if path == "" || path[0] != '/' {
+		path = "/" + path
+	}
+	return ctx.BaseURL() + path
+}
+
+func firstHeaderValue(v string) string {
+	if idx := strings.IndexByte(v, ','); idx != -1 {
+		v = v[:idx]
+	}
+	return strings.TrimSpace(v)
+}
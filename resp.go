@@ -8,22 +8,26 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
-	"github.com/missionMeteora/apiserv/internal"
 	tkErrors "github.com/missionMeteora/toolkit/errors"
 	"go.oneofone.dev/otk"
 )
 
 // Common responses
 var (
-	RespMethodNotAllowed Response = NewJSONErrorResponse(http.StatusMethodNotAllowed)
-	RespNotFound         Response = NewJSONErrorResponse(http.StatusNotFound)
-	RespForbidden        Response = NewJSONErrorResponse(http.StatusForbidden)
-	RespBadRequest       Response = NewJSONErrorResponse(http.StatusBadRequest)
-	RespOK               Response = NewJSONResponse("OK")
-	RespEmpty            Response = &simpleResp{code: http.StatusNoContent}
-	RespPlainOK          Response = &simpleResp{code: http.StatusOK}
-	RespRedirectRoot              = Redirect("/", false)
+	RespMethodNotAllowed  Response = NewJSONErrorResponse(http.StatusMethodNotAllowed)
+	RespNotFound          Response = NewJSONErrorResponse(http.StatusNotFound)
+	RespURITooLong        Response = NewJSONErrorResponse(http.StatusRequestURITooLong)
+	RespExpectationFailed Response = NewJSONErrorResponse(http.StatusExpectationFailed)
+	RespForbidden         Response = NewJSONErrorResponse(http.StatusForbidden)
+	RespBadRequest        Response = NewJSONErrorResponse(http.StatusBadRequest)
+	RespOK                Response = NewJSONResponse("OK")
+	RespAccepted          Response = staticJSONResp{Code: http.StatusAccepted}
+	RespEmpty             Response = &simpleResp{code: http.StatusNoContent}
+	RespPlainOK           Response = &simpleResp{code: http.StatusOK}
+	RespRedirectRoot               = Redirect("/", false)
 
 	// Break can be returned from a handler to break a handler chain.
 	// It doesn't write anything to the connection.
@@ -39,6 +43,7 @@ const (
 	MimeHTML       = "text/html; charset=utf-8"
 	MimePlain      = "text/plain; charset=utf-8"
 	MimeBinary     = "application/octet-stream"
+	MimeMsgpack    = "application/msgpack"
 )
 
 // Response represents a generic return type for http responses.
@@ -54,17 +59,108 @@ func NewJSONResponse(data interface{}) *JSONResponse {
 	}
 }
 
+// NewJSONResponseWithMeta returns a new success response (code 200) with the specific data and metadata,
+// for example the total count and next page of a list.
+func NewJSONResponseWithMeta(data, meta interface{}) *JSONResponse {
+	return &JSONResponse{
+		Code: http.StatusOK,
+		Data: data,
+		Meta: meta,
+	}
+}
+
+// NewCreatedResponse returns a new 201 response with the specific data and the Location header set to location.
+func NewCreatedResponse(data interface{}, location string) Response {
+	return locationResp{
+		Response: &JSONResponse{Code: http.StatusCreated, Data: data},
+		loc:      location,
+	}
+}
+
+// RespCreated returns an empty 201 response with the Location header set to location,
+// unlike the other Resp* values it has to be a func since the location is per request.
+func RespCreated(location string) Response {
+	return locationResp{
+		Response: &simpleResp{code: http.StatusCreated},
+		loc:      location,
+	}
+}
+
+// RespUnavailable returns a 503 error response with the Retry-After header set to retryAfter (rounded up to seconds),
+// the header is omitted if retryAfter <= 0.
+func RespUnavailable(retryAfter time.Duration) Response {
+	return retryAfterResp{
+		Response: NewJSONErrorResponse(http.StatusServiceUnavailable),
+		d:        retryAfter,
+	}
+}
+
+type retryAfterResp struct {
+	Response
+	d time.Duration
+}
+
+func (r retryAfterResp) WriteToCtx(ctx *Context) error {
+	if r.d > 0 {
+		secs := (r.d + time.Second - 1) / time.Second
+		ctx.Header().Set("Retry-After", strconv.FormatInt(int64(secs), 10))
+	}
+	return r.Response.WriteToCtx(ctx)
+}
+
+type locationResp struct {
+	Response
+	loc string
+}
+
+func (r locationResp) WriteToCtx(ctx *Context) error {
+	if r.loc != "" {
+		ctx.Header().Set("Location", r.loc)
+	}
+	return r.Response.WriteToCtx(ctx)
+}
+
+// DefaultReadJSONResponseLimit is the max response size read by ReadJSONResponse and ReadJSONResponseWithMeta.
+const DefaultReadJSONResponseLimit = 32 << 20 // 32mb
+
+// ErrResponseTooLarge is returned by ReadJSONResponseLimit if the response is larger than the limit.
+var ErrResponseTooLarge = errors.New("response body too large")
+
 // ReadJSONResponse reads a response from an io.ReadCloser and closes the body.
+// Up to DefaultReadJSONResponseLimit bytes are read, see ReadJSONResponseLimit.
 // dataValue is the data type you're expecting, for example:
 //	r, err := ReadJSONResponse(res.Body, &map[string]*Stats{})
 func ReadJSONResponse(rc io.ReadCloser, dataValue interface{}) (r *JSONResponse, err error) {
+	return readJSONResponse(rc, dataValue, nil, DefaultReadJSONResponseLimit)
+}
+
+// ReadJSONResponseWithMeta is like ReadJSONResponse, but also decodes the response's meta into metaValue.
+func ReadJSONResponseWithMeta(rc io.ReadCloser, dataValue, metaValue interface{}) (r *JSONResponse, err error) {
+	return readJSONResponse(rc, dataValue, metaValue, DefaultReadJSONResponseLimit)
+}
+
+// ReadJSONResponseLimit is like ReadJSONResponse, but returns ErrResponseTooLarge if the response is larger than maxBytes,
+// protecting clients from misbehaving servers. maxBytes <= 0 uses DefaultReadJSONResponseLimit.
+func ReadJSONResponseLimit(rc io.ReadCloser, dataValue interface{}, maxBytes int64) (r *JSONResponse, err error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultReadJSONResponseLimit
+	}
+	return readJSONResponse(rc, dataValue, nil, maxBytes)
+}
+
+func readJSONResponse(rc io.ReadCloser, dataValue, metaValue interface{}, maxBytes int64) (r *JSONResponse, err error) {
 	defer rc.Close()
 
 	r = &JSONResponse{
 		Data: dataValue,
+		Meta: metaValue,
 	}
 
-	if err = json.NewDecoder(rc).Decode(r); err != nil {
+	lr := &limitedReader{r: rc, left: maxBytes}
+	if err = json.NewDecoder(lr).Decode(r); err != nil {
+		if lr.exceeded {
+			err = ErrResponseTooLarge
+		}
 		return
 	}
 
@@ -84,6 +180,33 @@ func ReadJSONResponse(rc io.ReadCloser, dataValue interface{}) (r *JSONResponse,
 	return
 }
 
+// limitedReader is like io.LimitedReader, but fails instead of returning io.EOF once the limit is exceeded.
+type limitedReader struct {
+	r        io.Reader
+	left     int64
+	exceeded bool
+}
+
+func (l *limitedReader) Read(p []byte) (n int, err error) {
+	if l.left <= 0 {
+		// check if there's more data before failing, exactly maxBytes is fine
+		var b [1]byte
+		if n, _ = l.r.Read(b[:]); n > 0 {
+			l.exceeded = true
+			return 0, ErrResponseTooLarge
+		}
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > l.left {
+		p = p[:l.left]
+	}
+
+	n, err = l.r.Read(p)
+	l.left -= int64(n)
+	return
+}
+
 func JSONRequest(method, url string, reqData, respData interface{}) (err error) {
 	return otk.Request(method, "", url, reqData, func(r *http.Response) error {
 		_, err := ReadJSONResponse(r.Body, respData)
@@ -94,6 +217,7 @@ func JSONRequest(method, url string, reqData, respData interface{}) (err error)
 // JSONResponse is the default standard api response
 type JSONResponse struct {
 	Data    interface{} `json:"data,omitempty"`
+	Meta    interface{} `json:"meta,omitempty"` // ex: pagination info, see NewJSONResponseWithMeta
 	Errors  []*Error    `json:"errors,omitempty"`
 	Code    int         `json:"code"`
 	Success bool        `json:"success"`
@@ -102,22 +226,51 @@ type JSONResponse struct {
 
 // WriteToCtx writes the response to a ResponseWriter
 func (r *JSONResponse) WriteToCtx(ctx *Context) error {
-	switch r.Code {
-	case 0:
+	if r.Code == 0 {
 		if len(r.Errors) > 0 {
 			r.Code = http.StatusBadRequest
 		} else {
 			r.Code = http.StatusOK
 		}
+	}
 
-	case http.StatusNoContent: // special case
-		ctx.WriteHeader(http.StatusNoContent)
+	if r.Code == http.StatusOK && ctx.nextStatus > 0 { // see ctx.SetStatus, copy to avoid modifying shared responses
+		cp := *r
+		cp.Code, r = ctx.nextStatus, &cp
+	}
+
+	switch r.Code {
+	case http.StatusNoContent, http.StatusNotModified: // special case, no body allowed
+		ctx.WriteHeader(r.Code)
 		return nil
 	}
 
 	r.Success = r.Code >= http.StatusOK && r.Code < http.StatusBadRequest
 
-	return ctx.JSON(r.Code, r.Indent, r)
+	if !r.Success && ctx.wantsHTMLErrors() {
+		return ctx.writeHTMLError(r.Code, r.Errors)
+	}
+
+	var v interface{} = r
+	if ctx.s != nil && ctx.s.opts.JSONEnvelope != nil {
+		v = ctx.s.opts.JSONEnvelope(r)
+	}
+
+	if ProtoMarshal != nil && r.Success && r.Data != nil && acceptsProto(ctx.ReqHeader().Get("Accept")) {
+		if b, err := ProtoMarshal(r.Data); err == nil {
+			ctx.writeProto(r.Code, b)
+			return nil
+		}
+	}
+
+	if MsgpackMarshal != nil && acceptsMsgpack(ctx.ReqHeader().Get("Accept")) {
+		if v == r {
+			v = (*MsgpackResponse)(r)
+		}
+		return ctx.Msgpack(r.Code, v)
+	}
+
+	return ctx.JSON(r.Code, r.Indent, v)
 }
 
 func NewXMLResponse(data interface{}) *XMLResponse {
@@ -175,6 +328,12 @@ func (r *XMLResponse) WriteToCtx(ctx *Context) error {
 	return enc.Encode(r.Data)
 }
 
+// Fail is an alias for NewJSONErrorResponse, it reads better next to OK and Created:
+//	return apiserv.Fail(http.StatusNotFound, "user not found")
+func Fail(code int, errs ...interface{}) *JSONResponse {
+	return NewJSONErrorResponse(code, errs...)
+}
+
 // NewJSONErrorResponse returns a new error response.
 // each err can be:
 // 1. string or []byte
@@ -244,7 +403,7 @@ type Error struct {
 }
 
 func (e *Error) Error() string {
-	j, _ := internal.MarshalIndent(e)
+	j, _ := jsonMarshal(e, true)
 	return string(j)
 }
 
@@ -294,6 +453,23 @@ func (f fileResp) WriteToCtx(ctx *Context) error {
 	return ctx.File(f.fp)
 }
 
+// Attachment returns a download response named filename using the data from r.
+// If contentType is empty, it defaults to MimeBinary.
+// example: return Attachment("report.csv", "text/csv", rd)
+func Attachment(filename, contentType string, r io.Reader) Response {
+	return attachmentResp{filename, contentType, r}
+}
+
+type attachmentResp struct {
+	fname string
+	ct    string
+	r     io.Reader
+}
+
+func (a attachmentResp) WriteToCtx(ctx *Context) error {
+	return ctx.attachment(a.fname, a.ct, a.r)
+}
+
 // PlainResponse returns SimpleResponse(200, contentType, val).
 func PlainResponse(contentType string, val interface{}) Response {
 	return SimpleResponse(http.StatusOK, contentType, val)
@@ -309,6 +485,15 @@ func SimpleResponse(code int, contentType string, val interface{}) Response {
 	}
 }
 
+// staticJSONResp is a JSONResponse value that gets copied before it's written,
+// so it's safe to share between handlers.
+type staticJSONResp JSONResponse
+
+func (r staticJSONResp) WriteToCtx(ctx *Context) error {
+	jr := JSONResponse(r)
+	return jr.WriteToCtx(ctx)
+}
+
 type simpleResp struct {
 	v    interface{}
 	ct   string
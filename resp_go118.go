@@ -0,0 +1,15 @@
+//go:build go1.18
+// +build go1.18
+
+package apiserv
+
+// OK is a typed version of NewJSONResponse, it makes the response's data type clear at the call site, example:
+//	return apiserv.OK(user)
+func OK[T any](data T) *JSONResponse {
+	return NewJSONResponse(data)
+}
+
+// Created is a typed version of NewCreatedResponse.
+func Created[T any](data T, location string) Response {
+	return NewCreatedResponse(data, location)
+}
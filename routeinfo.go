@@ -0,0 +1,137 @@
+package apiserv
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// RouteInfo describes a registered route, see Server.RoutesInfo.
+type RouteInfo struct {
+	Group       string   `json:"group,omitempty"`
+	Method      string   `json:"method"`
+	Pattern     string   `json:"pattern"`
+	Name        string   `json:"name,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Params      []string `json:"params,omitempty"` // ex: [":id", "*fp"]
+	Middlewares int      `json:"middlewares"`      // the group's middlewares, including the global ones
+	Handlers    int      `json:"handlers"`
+}
+
+type routeChain struct {
+	g        *group
+	handlers int
+}
+
+func (s *Server) addRouteChain(method, path string, ghc *groupHandlerChain) {
+	s.serversMux.Lock()
+	defer s.serversMux.Unlock()
+
+	if n := len(path) - 1; n > 0 && path[n] == '/' {
+		path = path[:n]
+	}
+
+	if s.routeChains == nil {
+		s.routeChains = map[string]routeChain{}
+	}
+	s.routeChains[method+" "+path] = routeChain{g: ghc.g, handlers: len(ghc.hc)}
+}
+
+// Describe attaches a description to the route matching method and the full path pattern (including the group's path),
+// it shows up in RoutesInfo.
+func (s *Server) Describe(method, path, desc string) {
+	s.serversMux.Lock()
+	defer s.serversMux.Unlock()
+
+	if s.routeDescs == nil {
+		s.routeDescs = map[string]string{}
+	}
+	s.routeDescs[method+" "+path] = desc
+}
+
+// RoutesInfo returns all the registered routes sorted by pattern then method,
+// including their names (see AddNamedRoute), descriptions (see Describe), path params and handler counts.
+// It is meant to be used to generate documentation or client SDKs.
+func (s *Server) RoutesInfo() []RouteInfo {
+	s.serversMux.Lock()
+	defer s.serversMux.Unlock()
+
+	names := make(map[string]string, len(s.namedRoutes))
+	for name, path := range s.namedRoutes {
+		names[path] = name
+	}
+
+	routes := s.r.GetRoutes()
+	out := make([]RouteInfo, 0, len(routes))
+	for _, r := range routes {
+		pattern := r[2]
+		for strings.Contains(pattern, "//") {
+			pattern = strings.Replace(pattern, "//", "/", -1)
+		}
+
+		ri := RouteInfo{
+			Group:       r[0],
+			Method:      r[1],
+			Pattern:     pattern,
+			Name:        names[pattern],
+			Description: s.routeDescs[r[1]+" "+pattern],
+		}
+
+		if rc, ok := s.routeChains[r[1]+" "+pattern]; ok {
+			ri.Middlewares, ri.Handlers = len(rc.g.mw), rc.handlers
+		}
+
+		for _, p := range strings.Split(pattern, "/") {
+			if p != "" && (p[0] == ':' || p[0] == '*') {
+				ri.Params = append(ri.Params, p)
+			}
+		}
+
+		out = append(out, ri)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Pattern != out[j].Pattern {
+			return out[i].Pattern < out[j].Pattern
+		}
+		return out[i].Method < out[j].Method
+	})
+
+	return out
+}
+
+// DebugRoutesHandler returns a handler that lists all the registered routes (see RoutesInfo) as json,
+// or as an html table if the client prefers text/html (ex: a browser) or ?format=html is passed.
+// It exposes the whole api surface, so it should be mounted behind auth, for example:
+//	dbg := srv.Group("debug", "/_debug", requireAdmin)
+//	dbg.GET("/routes", srv.DebugRoutesHandler())
+func (s *Server) DebugRoutesHandler() Handler {
+	return func(ctx *Context) Response {
+		routes := s.RoutesInfo()
+
+		if ctx.Query("format") != "html" && !strings.Contains(ctx.ReqHeader().Get("Accept"), "text/html") {
+			return NewJSONResponse(routes)
+		}
+
+		var buf bytes.Buffer
+		if err := debugRoutesTmpl.Execute(&buf, routes); err != nil {
+			return NewJSONErrorResponse(http.StatusInternalServerError, err)
+		}
+
+		return PlainResponse(MimeHTML, buf.Bytes())
+	}
+}
+
+var debugRoutesTmpl = template.Must(template.New("routes").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Routes</title></head>
+<body>
+<table border="1" cellpadding="4">
+<tr><th>Method</th><th>Pattern</th><th>Group</th><th>Name</th><th>Middlewares</th><th>Handlers</th><th>Description</th></tr>
+{{range .}}<tr><td>{{.Method}}</td><td>{{.Pattern}}</td><td>{{.Group}}</td><td>{{.Name}}</td><td>{{.Middlewares}}</td><td>{{.Handlers}}</td><td>{{.Description}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
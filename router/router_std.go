@@ -6,6 +6,7 @@ package router
 import (
 	"fmt"
 	"net/http"
+	"strings"
 )
 
 // Handler is what handler looks like, duh?
@@ -37,34 +38,81 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 	u, method := req.URL.Path, req.Method
 
+	if method == http.MethodHead && !r.opts.NoAutoHeadToGet {
+		w, method = &headRW{ResponseWriter: w}, http.MethodGet
+	}
+
 	if !r.opts.NoAutoCleanURL {
 		var ok bool
 		if u, ok = cleanPath(u); ok {
+			if r.opts.RedirectFixedPath && (method == http.MethodGet || !r.opts.RedirectFixedPathOnlyGET) && r.redirect(w, req, method, u) {
+				return
+			}
 			req.URL.Path = u
 		}
 	}
 
-	if method == http.MethodHead && !r.opts.NoAutoHeadToGet {
-		w, method = &headRW{ResponseWriter: w}, http.MethodGet
-	}
-
 	if h, p := r.match(method, pathNoQuery(u)); h != nil {
 		h(w, req, p.Params())
 		r.putParams(p)
 		return
 	}
 
-	if method == http.MethodGet {
-		if r.NotFoundHandler != nil {
-			r.NotFoundHandler(w, req, nil)
+	if method == http.MethodOptions && r.opts.AutoOptions {
+		if allowed := r.AllowedMethods(pathNoQuery(u)); len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(append(allowed, http.MethodOptions), ", "))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	if ru := u; r.opts.RedirectTrailingSlash && len(ru) > 1 {
+		if ru[len(ru)-1] == '/' {
+			ru = ru[:len(ru)-1]
 		} else {
-			w.WriteHeader(http.StatusNotFound)
+			ru += "/"
 		}
-	} else {
+
+		if r.redirect(w, req, method, ru) {
+			return
+		}
+	}
+
+	if allowed := r.AllowedMethods(pathNoQuery(u)); len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
 		if r.MethodNotAllowedHandler != nil {
 			r.MethodNotAllowedHandler(w, req, nil)
 		} else {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 		}
+		return
+	}
+
+	if r.NotFoundHandler != nil {
+		r.NotFoundHandler(w, req, nil)
+	} else {
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// redirect redirects to path if it has a handler, it uses 301 for GET and HEAD requests
+// and 308 for everything else so the body is preserved.
+func (r *Router) redirect(w http.ResponseWriter, req *http.Request, method, path string) bool {
+	h, p := r.match(method, pathNoQuery(path))
+	r.putParams(p)
+
+	if h == nil {
+		return false
 	}
+
+	code := http.StatusMovedPermanently
+	if method != http.MethodGet {
+		code = http.StatusPermanentRedirect
+	}
+
+	u := *req.URL
+	u.Path, u.RawPath = path, ""
+	http.Redirect(w, req, u.String(), code)
+
+	return true
 }
@@ -52,6 +52,19 @@ func splitPathToParts(p string) (pp string, rest []nodePart, num, stars int) {
 	return
 }
 
+// StarParam returns the name of the path's trailing catch-all param (ex: "fp" for /static/*fp),
+// or an empty string if it doesn't have one.
+func StarParam(p string) string {
+	_, parts, _, stars := splitPathToParts(p)
+	if stars == 0 {
+		return ""
+	}
+	if last := parts[len(parts)-1]; last.Type() == '*' {
+		return last.Name()
+	}
+	return ""
+}
+
 func splitPathFn(s string, sep uint8, fn func(p string, pidx, idx int) bool) bool {
 	for i, pi, last := 0, 0, 0; i < len(s); i++ {
 		if s[i] != sep {
@@ -14,6 +14,31 @@ type Options struct {
 	NoPanicOnInvalidAddRoute bool // don't panic on invalid routes, return an error instead
 	NoCatchPanics            bool // don't catch panics
 	NoAutoHeadToGet          bool // disable automatically handling HEAD requests
+
+	// RedirectTrailingSlash redirects /path/ to /path (and vice versa) if only the other one has a handler.
+	// Routes ending with a *param (ex: Static) match both forms and are never redirected,
+	// note that http.FileServer does its own directory redirects.
+	RedirectTrailingSlash bool
+
+	// RedirectFixedPath redirects to the cleaned up path (ex: /a//b/../c -> /a/c) instead of silently rewriting it,
+	// it does nothing if NoAutoCleanURL is set.
+	RedirectFixedPath bool
+
+	// RedirectFixedPathOnlyGET limits RedirectFixedPath to GET and HEAD requests, other methods are rewritten in place
+	// since most clients don't resend the body on redirects.
+	RedirectFixedPathOnlyGET bool
+
+	// AutoOptions answers OPTIONS requests for paths without an OPTIONS handler with a 204 and an Allow header
+	// listing the path's methods.
+	AutoOptions bool
+
+	// CaseInsensitive matches the static parts of routes regardless of their ASCII case (ex: /Users/:id matches /users/1),
+	// param values keep their original case. It costs a lowercased copy of the path per request.
+	CaseInsensitive bool
+
+	// CaseSensitiveStars exempts routes ending with a *param (ex: Static) from CaseInsensitive,
+	// their static prefix has to match exactly.
+	CaseSensitiveStars bool
 }
 
 var (
@@ -23,10 +48,19 @@ var (
 	ErrStarNotLast = errors.New("star param must be the last part of the path")
 )
 
+// methods in the same order as Router.methods
+var methods = [...]string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace,
+}
+
 type node struct {
 	g     string
 	h     Handler
 	parts []nodePart
+
+	prefix string // the route's original static prefix, the routeMap key is lowercased if CaseInsensitive is set
+	exact  bool   // the node is exempt from CaseInsensitive
 }
 
 func (n node) hasStar() bool {
@@ -80,10 +114,9 @@ func (r *Router) GetRoutes() [][3]string {
 	rms := r.getAllMaps()
 	routes := make([][3]string, 0, len(rms))
 	for method, rm := range rms {
-		for p, ns := range rm {
-			base := p
+		for _, ns := range rm {
 			for _, n := range ns {
-				route := base
+				route := n.prefix
 				for _, np := range n.parts {
 					route += "/" + string(np)
 				}
@@ -116,8 +149,14 @@ func (r *Router) AddRoute(group, method, route string, h Handler) error {
 		p = p[:n]
 	}
 
+	n := node{g: group, h: h, parts: rest, prefix: p}
+	if r.opts.CaseInsensitive {
+		n.exact = stars == 1 && r.opts.CaseSensitiveStars
+		p = lowerASCII(p)
+	}
+
 	m := r.getMap(method, true)
-	m.append(p, node{g: group, h: h, parts: rest})
+	m.append(p, n)
 
 	if num > r.maxParams {
 		r.maxParams = num
@@ -141,14 +180,20 @@ func (r *Router) Match(method, path string) (handler Handler, params Params) {
 func (r *Router) match(method, path string) (handler Handler, params *paramsWrapper) {
 	m := r.getMap(method, false)
 	var (
-		nn   []node
-		rn   node
-		nsep int
+		nn     []node
+		rn     node
+		nsep   int
+		prefix = "/"
+		lpath  = path
 	)
 
-	if !revSplitPathFn(path, '/', func(p string, pidx, idx int) bool {
-		if nn = m.get(path[:idx]); nn != nil {
-			path, nsep = path[idx:], pidx
+	if r.opts.CaseInsensitive {
+		lpath = lowerASCII(path)
+	}
+
+	if !revSplitPathFn(lpath, '/', func(p string, pidx, idx int) bool {
+		if nn = m.get(lpath[:idx]); nn != nil {
+			prefix, path, nsep = path[:idx], path[idx:], pidx
 			return true
 		}
 
@@ -162,6 +207,10 @@ func (r *Router) match(method, path string) (handler Handler, params *paramsWrap
 	}
 
 	for _, n := range nn {
+		if n.exact && n.prefix != prefix {
+			continue
+		}
+
 		if len(n.parts) == nsep || n.hasStar() {
 			rn = n
 			handler = n.h
@@ -180,7 +229,7 @@ func (r *Router) match(method, path string) (handler Handler, params *paramsWrap
 		case ':':
 			params.p = append(params.p, Param{np.Name(), p[1:]})
 		case '*':
-			params.p = append(params.p, Param{np.Name(), path[1:]})
+			params.p = append(params.p, Param{np.Name(), path[idx-len(p)+1:]})
 			return true
 		}
 		return false
@@ -189,6 +238,22 @@ func (r *Router) match(method, path string) (handler Handler, params *paramsWrap
 	return
 }
 
+// AllowedMethods returns all the methods that have a handler matching path.
+func (r *Router) AllowedMethods(path string) (out []string) {
+	for _, method := range methods {
+		h, p := r.match(method, path)
+		r.putParams(p)
+
+		if h != nil {
+			out = append(out, method)
+		} else if method == http.MethodHead && !r.opts.NoAutoHeadToGet && len(out) > 0 && out[0] == http.MethodGet {
+			out = append(out, method)
+		}
+	}
+
+	return
+}
+
 func (r *Router) getAllMaps() map[string]routeMap {
 	out := make(map[string]routeMap)
 	for i, rm := range &r.methods {
@@ -259,3 +324,19 @@ func (r *Router) putParams(p *paramsWrapper) {
 	p.p = p.p[:0]
 	r.pp.Put(p)
 }
+
+// lowerASCII lowercases the ASCII letters of s, unlike strings.ToLower it never changes the length.
+func lowerASCII(s string) string {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; 'A' <= c && c <= 'Z' {
+			b := []byte(s)
+			for j := i; j < len(b); j++ {
+				if c := b[j]; 'A' <= c && c <= 'Z' {
+					b[j] = c + ('a' - 'A')
+				}
+			}
+			return string(b)
+		}
+	}
+	return s
+}
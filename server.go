@@ -1,16 +1,17 @@
 package apiserv
 
 import (
-	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/missionMeteora/apiserv/router"
@@ -25,6 +26,9 @@ var DefaultOpts = Options{
 
 	KeepAlivePeriod: 3 * time.Minute, // default value in net/http
 
+	ShutdownSignals: []os.Signal{os.Interrupt, syscall.SIGTERM},
+	ShutdownTimeout: 30 * time.Second,
+
 	Logger: log.New(os.Stderr, "apiserv: ", 0),
 }
 
@@ -54,20 +58,11 @@ func NewWithOpts(opts *Options) *Server {
 	srv.r = router.New(ro)
 
 	if ro == nil || !ro.NoCatchPanics {
+		// panics in handlers are handled by the handler chain itself, this catches everything else
 		srv.r.PanicHandler = func(w http.ResponseWriter, req *http.Request, v interface{}) {
-			srv.Logf("PANIC (%T): %v", v, v)
-			if h := srv.PanicHandler; h != nil {
-				ctx := getCtx(w, req, nil, srv)
-				h(ctx, v)
-				putCtx(ctx)
-				return
-			}
-
-			resp := NewJSONErrorResponse(http.StatusInternalServerError, fmt.Sprintf("PANIC (%T): %v", v, v))
-			resp.WriteToCtx(&Context{
-				Req:            req,
-				ResponseWriter: w,
-			})
+			ctx := getCtx(w, req, nil, srv)
+			srv.handlePanic(ctx, v)
+			putCtx(ctx)
 		}
 	}
 
@@ -79,12 +74,33 @@ func NewWithOpts(opts *Options) *Server {
 			return
 		}
 
+		if h := srv.opts.NotFoundHandler; h != nil {
+			ghc := groupHandlerChain{g: srv.group, hc: []Handler{h}}
+			ghc.Serve(w, req, p)
+			return
+		}
+
 		RespNotFound.WriteToCtx(&Context{
 			Req:            req,
 			ResponseWriter: w,
+			s:              srv,
 		})
 	}
 
+	srv.r.MethodNotAllowedHandler = func(w http.ResponseWriter, req *http.Request, p router.Params) {
+		ctx := getCtx(w, req, p, srv)
+		defer putCtx(ctx)
+
+		if h := srv.opts.MethodNotAllowedHandler; h != nil {
+			if r := h(ctx); r != nil && r != Break && !ctx.done {
+				r.WriteToCtx(ctx)
+			}
+			return
+		}
+
+		RespMethodNotAllowed.WriteToCtx(ctx)
+	}
+
 	srv.group = &group{s: srv}
 
 	return srv
@@ -93,33 +109,94 @@ func NewWithOpts(opts *Options) *Server {
 // Server is the main server
 type Server struct {
 	*group
-	r               *router.Router
-	PanicHandler    func(ctx *Context, v interface{})
+	r            *router.Router
+	PanicHandler func(ctx *Context, v interface{})
+
+	// NotFoundHandler is called when no route matches the request, unlike the NotFoundHandler option,
+	// it doesn't run the global middlewares. If both are set, this takes precedence.
+	//
+	// Deprecated: use the NotFoundHandler option.
 	NotFoundHandler func(ctx *Context)
-	servers         []*http.Server
-	opts            Options
-	serversMux      sync.Mutex
-	closed          int32
+
+	servers      []*http.Server
+	readyChecks  []namedCheck
+	namedRoutes  map[string]string
+	routeDescs   map[string]string
+	routeChains  map[string]routeChain
+	unixSockets  []string
+	opts         Options
+	serversMux   sync.Mutex
+	closed       int32
+	noKeepAlives bool
 }
 
 // ServeHTTP allows using the server in custom scenarios that expects an http.Handler.
 func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if fn := s.opts.ResponseTap; fn != nil {
+		t := &tapRW{ResponseWriter: w, max: s.opts.ResponseTapMaxBody}
+		if t.max <= 0 {
+			t.max = DefaultResponseTapMaxBody
+		}
+		defer t.done(req, fn)
+		w = t
+	}
+
+	if n := s.opts.MaxURILength; n > 0 && len(requestURI(req)) > n {
+		RespURITooLong.WriteToCtx(&Context{
+			Req:            req,
+			ResponseWriter: w,
+			s:              s,
+		})
+		return
+	}
+
+	if fn := s.opts.CheckContinue; fn != nil && expectsContinue(req) && !fn(req) {
+		RespExpectationFailed.WriteToCtx(&Context{
+			Req:            req,
+			ResponseWriter: w,
+			s:              s,
+		})
+		return
+	}
+
 	s.r.ServeHTTP(w, req)
 }
 
+func expectsContinue(req *http.Request) bool {
+	return strings.EqualFold(req.Header.Get("Expect"), "100-continue")
+}
+
+func requestURI(req *http.Request) string {
+	if req.RequestURI != "" {
+		return req.RequestURI
+	}
+	return req.URL.RequestURI()
+}
+
 func (s *Server) newHTTPServer(addr string) *http.Server {
 	opts := &s.opts
-	return &http.Server{
-		Addr:           addr,
-		Handler:        s.r,
-		ReadTimeout:    opts.ReadTimeout,
-		WriteTimeout:   opts.WriteTimeout,
-		MaxHeaderBytes: opts.MaxHeaderBytes,
-		ErrorLog:       opts.Logger,
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s,
+		ReadTimeout:       opts.ReadTimeout,
+		ReadHeaderTimeout: opts.ReadHeaderTimeout,
+		WriteTimeout:      opts.WriteTimeout,
+		MaxHeaderBytes:    opts.MaxHeaderBytes,
+		ErrorLog:          opts.Logger,
+		ConnState:         opts.ConnState,
 	}
+
+	s.serversMux.Lock()
+	if s.noKeepAlives {
+		srv.SetKeepAlivesEnabled(false)
+	}
+	s.serversMux.Unlock()
+
+	return srv
 }
 
-// Run starts the server on the specific address
+// Run starts the server on the specific address, it blocks until the server stops.
+// It returns the listen error, or http.ErrServerClosed once Shutdown/Close is called, see RunContext.
 func (s *Server) Run(addr string) error {
 	if addr == "" {
 		addr = ":http"
@@ -130,17 +207,141 @@ func (s *Server) Run(addr string) error {
 		return err
 	}
 
+	return s.Serve(ln)
+}
+
+// Serve starts the server on the passed listener, useful for pre-bound sockets or testing.
+// The listener is owned by the server and will be closed on Close/Shutdown.
+func (s *Server) Serve(ln net.Listener) error {
 	srv := s.newHTTPServer(ln.Addr().String())
 
 	s.serversMux.Lock()
 	s.servers = append(s.servers, srv)
 	s.serversMux.Unlock()
 
-	if s.opts.KeepAlivePeriod < 1 {
-		return srv.Serve(ln)
+	return s.serve(srv, ln)
+}
+
+func (s *Server) serve(srv *http.Server, ln net.Listener) error {
+	if tln, ok := ln.(*net.TCPListener); ok && s.opts.KeepAlivePeriod > 0 {
+		return srv.Serve(&tcpKeepAliveListener{tln, s.opts.KeepAlivePeriod})
 	}
 
-	return srv.Serve(&tcpKeepAliveListener{ln.(*net.TCPListener), s.opts.KeepAlivePeriod})
+	return srv.Serve(ln)
+}
+
+// RunMany starts the server on all the passed addresses, sharing the same routes and options.
+// If any of the addresses fails to listen, none of them are started.
+// It returns the first error, after stopping the rest of the listeners started by this call,
+// or http.ErrServerClosed once Shutdown/Close is called.
+func (s *Server) RunMany(addrs ...string) error {
+	if len(addrs) == 0 {
+		addrs = []string{""}
+	}
+
+	lns := make([]net.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		if addr == "" {
+			addr = ":http"
+		}
+
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+			return err
+		}
+
+		lns = append(lns, ln)
+	}
+
+	srvs := make([]*http.Server, len(lns))
+	for i, ln := range lns {
+		srvs[i] = s.newHTTPServer(ln.Addr().String())
+	}
+
+	s.serversMux.Lock()
+	s.servers = append(s.servers, srvs...)
+	s.serversMux.Unlock()
+
+	errCh := make(chan error, len(lns))
+	for i, ln := range lns {
+		go func(srv *http.Server, ln net.Listener) {
+			errCh <- s.serve(srv, ln)
+		}(srvs[i], ln)
+	}
+
+	err := <-errCh
+	if err != http.ErrServerClosed {
+		for _, srv := range srvs {
+			srv.Close()
+		}
+	}
+
+	for range srvs[1:] {
+		<-errCh
+	}
+
+	return err
+}
+
+// ListenUnix starts the server on a unix socket at path,
+// a stale socket file at path is removed first and the socket file is removed on Close/Shutdown.
+func (s *Server) ListenUnix(path string) error {
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err = os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+
+	s.serversMux.Lock()
+	s.unixSockets = append(s.unixSockets, path)
+	s.serversMux.Unlock()
+
+	return s.Serve(ln)
+}
+
+func (s *Server) removeUnixSockets() {
+	for _, fp := range s.unixSockets {
+		if err := os.Remove(fp); err != nil && !os.IsNotExist(err) {
+			s.Logf("error removing unix socket %s: %v", fp, err)
+		}
+	}
+	s.unixSockets = nil
+}
+
+// RunWithGracefulShutdown is like Run, but it listens for the configured ShutdownSignals (see SetShutdownSignals)
+// and gracefully shuts down the server when one is received, waiting up to timeout for active connections.
+// It returns nil on a graceful stop, or the listen / shutdown error otherwise.
+func (s *Server) RunWithGracefulShutdown(addr string, timeout time.Duration) error {
+	sigs := s.opts.ShutdownSignals
+	if len(sigs) == 0 {
+		sigs = DefaultOpts.ShutdownSignals
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, sigs...)
+	defer signal.Stop(sigCh)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.Run(addr) }()
+
+	select {
+	case err := <-errCh:
+		if err == http.ErrServerClosed {
+			return nil
+		}
+		return err
+	case sig := <-sigCh:
+		s.Logf("received %v, shutting down", sig)
+		return s.Shutdown(timeout)
+	}
 }
 
 // CertPair is a pair of (cert, key) files to listen on TLS
@@ -149,10 +350,13 @@ type CertPair struct {
 	KeyFile  string `json:"KeyFile"`
 }
 
-// SetKeepAlivesEnabled controls whether HTTP keep-alives are enabled.
-// By default, keep-alives are always enabled.
+// SetKeepAlivesEnabled controls whether HTTP keep-alives are enabled, it applies to all the running
+// and future underlying http servers, disabling it is useful to drain connections before a shutdown.
+// By default, keep-alives are always enabled, Shutdown and Close always disable them.
+// Not to be confused with the socket-level keepalive, which is controlled by the SetKeepAlivePeriod option.
 func (s *Server) SetKeepAlivesEnabled(v bool) {
 	s.serversMux.Lock()
+	s.noKeepAlives = !v
 	for _, srv := range s.servers {
 		srv.SetKeepAlivesEnabled(v)
 	}
@@ -201,6 +405,28 @@ func (s *Server) logfStack(n int, f string, args ...interface{}) {
 	lg.Printf(strings.Join(parts, "/")+":"+strconv.Itoa(line)+": "+f, args...)
 }
 
+// Mount serves all the methods of all the paths under prefix using h, with the prefix stripped from the request's path.
+// The global middlewares (added with s.Use) run before h, group middlewares don't apply.
+// Note that some handlers expect the full path (ex: net/http/pprof), those should be added with
+// s.AddRoute(method, "/debug/pprof/*fp", FromHTTPHandler(h)) instead.
+// it is NOT safe to call this once you call one of the run functions
+func (s *Server) Mount(prefix string, h http.Handler) error {
+	prefix = strings.TrimSuffix(prefix, "/")
+	hh := FromHTTPHandler(http.StripPrefix(prefix, h))
+	path := joinPath(prefix, "*mountPath")
+
+	for _, m := range [...]string{
+		http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace,
+	} {
+		if err := s.AddRoute(m, path, hh); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // AllowCORS is an alias for s.AddRoute("OPTIONS", path, AllowCORS(allowedMethods...))
 func (s *Server) AllowCORS(path string, allowedMethods ...string) error {
 	return s.AddRoute(http.MethodOptions, path, AllowCORS(allowedMethods, nil, nil))
@@ -0,0 +1,84 @@
+//go:build go1.18
+// +build go1.18
+
+package apiserv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testUser struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestGetSetValue(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.Use(func(ctx *Context) Response {
+		SetValue(ctx, "user", &testUser{ID: 1, Name: "x"})
+		SetValue(ctx, "n", 42)
+		return nil
+	})
+	srv.GET("/", func(ctx *Context) Response {
+		u, ok := GetValue[*testUser](ctx, "user")
+		if !ok || u.Name != "x" {
+			t.Errorf("unexpected user: %v %v", u, ok)
+		}
+
+		if n, ok := GetValue[string](ctx, "n"); ok || n != "" {
+			t.Errorf("expected a type mismatch, got %q %v", n, ok)
+		}
+
+		if _, ok := GetValue[int](ctx, "missing"); ok {
+			t.Error("expected a missing key")
+		}
+		return RespOK
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func TestOKCreated(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.GET("/users/1", func(ctx *Context) Response {
+		return OK(testUser{ID: 1, Name: "x"})
+	})
+	srv.POST("/users", func(ctx *Context) Response {
+		return Created(testUser{ID: 2, Name: "y"}, "/users/2")
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/users/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var u testUser
+	if _, err = ReadJSONResponse(resp.Body, &u); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || u.ID != 1 || u.Name != "x" {
+		t.Fatalf("unexpected response (%d): %+v", resp.StatusCode, u)
+	}
+
+	if resp, err = http.Post(ts.URL+"/users", MimeJSON, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ReadJSONResponse(resp.Body, &u); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("Location") != "/users/2" || u.ID != 2 {
+		t.Fatalf("unexpected response (%d) %v: %+v", resp.StatusCode, resp.Header, u)
+	}
+}
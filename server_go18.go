@@ -4,7 +4,9 @@ package apiserv
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"sync/atomic"
 	"time"
@@ -23,13 +25,21 @@ func (s *Server) Close() error {
 	}
 
 	s.servers = nil
+	s.removeUnixSockets()
 	s.serversMux.Unlock()
 
 	return me.Err()
 }
 
+// ErrForcedShutdown is returned from Shutdown if connections were still active after the ShutdownGracePeriod
+// and had to be forcibly closed.
+var ErrForcedShutdown = errors.New("shutdown grace period expired, active connections were closed")
+
 // Shutdown gracefully shutsdown all the underlying http servers.
-// You can optionally set a timeout.
+// You can optionally set a timeout, if it's <= 0 it waits for all the active connections to finish,
+// once it expires Shutdown returns context.DeadlineExceeded and the remaining connections are left open.
+// If the ShutdownGracePeriod option is set, connections still active after min(timeout, grace period) are closed
+// and ErrForcedShutdown is returned.
 func (s *Server) Shutdown(timeout time.Duration) error {
 	if !atomic.CompareAndSwapInt32(&s.closed, 0, 1) {
 		return http.ErrServerClosed
@@ -40,6 +50,11 @@ func (s *Server) Shutdown(timeout time.Duration) error {
 		ctx = context.Background()
 	)
 
+	grace := s.opts.ShutdownGracePeriod
+	if grace > 0 && (timeout <= 0 || grace < timeout) {
+		timeout = grace
+	}
+
 	if timeout > 0 {
 		var cancelFn func()
 		ctx, cancelFn = context.WithDeadline(ctx, time.Now().Add(timeout))
@@ -47,12 +62,63 @@ func (s *Server) Shutdown(timeout time.Duration) error {
 	}
 
 	s.serversMux.Lock()
+	forced := false
 	for _, srv := range s.servers {
 		srv.SetKeepAlivesEnabled(false)
-		me.Push(srv.Shutdown(ctx))
+		err := srv.Shutdown(ctx)
+		if err == context.DeadlineExceeded && grace > 0 {
+			srv.Close()
+			forced = true
+			continue
+		}
+		me.Push(err)
+	}
+
+	if forced {
+		me.Push(ErrForcedShutdown)
 	}
+
 	s.servers = nil
+	s.removeUnixSockets()
 	s.serversMux.Unlock()
 
 	return me.Err()
 }
+
+// RunContext is like Run, but it gracefully shuts down the server (see Shutdown) once ctx is canceled,
+// waiting up to the ShutdownTimeout option for active connections.
+// It returns nil on a clean shutdown, or the listen / shutdown error otherwise.
+func (s *Server) RunContext(ctx context.Context, addr string) error {
+	if addr == "" {
+		addr = ":http"
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	// register the server before serving so a cancel can't race with it
+	srv := s.newHTTPServer(ln.Addr().String())
+	s.serversMux.Lock()
+	s.servers = append(s.servers, srv)
+	s.serversMux.Unlock()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.serve(srv, ln) }()
+
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = s.Shutdown(s.opts.ShutdownTimeout)
+		if serr := <-errCh; err == nil {
+			err = serr
+		}
+	}
+
+	if err == http.ErrServerClosed {
+		return nil
+	}
+
+	return err
+}
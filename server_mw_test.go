@@ -2,8 +2,23 @@ package apiserv
 
 import (
 	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
 	"net/http"
 	"net/http/cookiejar"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -57,3 +72,705 @@ func TestSecureCookie(t *testing.T) {
 		t.Fatalf("unexpected response: %#+v", respValue)
 	}
 }
+
+func TestLocalization(t *testing.T) {
+	supported := []string{"en-US", "fr", "de-DE"}
+	tests := []struct {
+		accept, lang string
+	}{
+		{"", "en-US"},
+		{"fr-CA, en;q=0.8", "fr"},
+		{"de;q=0.5, fr;q=0.7", "fr"},
+		{"es, de-de;q=0.1", "de-DE"},
+		{"es, *;q=0.5", "en-US"},
+		{"fr;q=0, en", "en-US"},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Language", tc.accept)
+		ctx := &Context{Req: req, data: M{}}
+
+		Localization(supported)(ctx)
+		if lang := ctx.Get(LangContextKey); lang != tc.lang {
+			t.Fatalf("%q: expected %s, got %v", tc.accept, tc.lang, lang)
+		}
+	}
+}
+
+func TestRequireContentType(t *testing.T) {
+	h := RequireContentType(MimeJSON)
+	tests := []struct {
+		method, ct, body string
+		ok               bool
+	}{
+		{http.MethodPost, "application/json; charset=utf-8", "{}", true},
+		{http.MethodPost, "Application/JSON", "{}", true},
+		{http.MethodPost, "application/x-www-form-urlencoded", "a=b", false},
+		{http.MethodPut, "", "{}", false},
+		{http.MethodPost, "", "", true},
+		{http.MethodGet, "text/plain", "", true},
+		{http.MethodDelete, "", "", true},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest(tc.method, "/", strings.NewReader(tc.body))
+		if tc.ct != "" {
+			req.Header.Set("Content-Type", tc.ct)
+		}
+		ctx := &Context{Req: req, data: M{}}
+
+		r := h(ctx)
+		if tc.ok != (r == nil) {
+			t.Fatalf("%s %q: unexpected response: %v", tc.method, tc.ct, r)
+		}
+
+		if r != nil && r.(*JSONResponse).Code != http.StatusUnsupportedMediaType {
+			t.Fatalf("%s %q: unexpected code: %d", tc.method, tc.ct, r.(*JSONResponse).Code)
+		}
+	}
+}
+
+func TestAPIVersion(t *testing.T) {
+	mw := APIVersion(VersionOptions{
+		Header:      "X-API-Version",
+		Vendor:      "myapp",
+		AcceptParam: "version",
+		Default:     "v1",
+		Supported:   []string{"1", "2"},
+	})
+	h := VersionRouter(map[string]Handler{
+		"v1": func(ctx *Context) Response { return NewJSONResponse("one") },
+		"v2": func(ctx *Context) Response { return NewJSONResponse("two") },
+	}, nil)
+
+	tests := []struct {
+		hdr, val, ver string
+		bad           bool
+	}{
+		{"", "", "1", false},
+		{"X-API-Version", "V2", "2", false},
+		{"Accept", "application/vnd.myapp.v2+json", "2", false},
+		{"Accept", "text/html, application/json; version=2", "2", false},
+		{"Accept", "application/vnd.other.v2+json", "1", false},
+		{"X-API-Version", "3", "", true},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tc.hdr != "" {
+			req.Header.Set(tc.hdr, tc.val)
+		}
+		ctx := &Context{Req: req, data: M{}}
+
+		if r := mw(ctx); (r != nil) != tc.bad {
+			t.Fatalf("%s: %s: unexpected response: %v", tc.hdr, tc.val, r)
+		}
+
+		if tc.bad {
+			continue
+		}
+
+		if v := ctx.APIVersion(); v != tc.ver {
+			t.Fatalf("%s: %s: expected %s, got %s", tc.hdr, tc.val, tc.ver, v)
+		}
+
+		exp := map[string]string{"1": "one", "2": "two"}[tc.ver]
+		if r := h(ctx).(*JSONResponse); r.Data != exp {
+			t.Fatalf("%s: %s: expected %s, got %v", tc.hdr, tc.val, exp, r.Data)
+		}
+	}
+}
+
+func TestCompression(t *testing.T) {
+	RegisterCompressor("deflate", func(w io.Writer, level int) (io.WriteCloser, error) {
+		return flate.NewWriter(w, level)
+	})
+	defer RegisterCompressor("deflate", nil)
+
+	srv := New(SetErrLogger(nil))
+	srv.Use(Compression(CompressionOptions{Algorithms: []string{"br", "deflate", "gzip"}}))
+	srv.GET("/", func(ctx *Context) Response {
+		return NewJSONResponse(strings.Repeat("x", 1024))
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	tests := []struct {
+		accept, enc string
+	}{
+		{"gzip, deflate, br", "deflate"},
+		{"gzip, deflate;q=0.5", "gzip"},
+		{"br", ""},
+		{"", ""},
+	}
+
+	for _, tc := range tests {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+		req.Header.Set("Accept-Encoding", tc.accept)
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var rd io.Reader = resp.Body
+		switch enc := resp.Header.Get("Content-Encoding"); enc {
+		case "gzip":
+			rd, _ = gzip.NewReader(rd)
+		case "deflate":
+			rd = flate.NewReader(rd)
+		}
+		b, _ := io.ReadAll(rd)
+		resp.Body.Close()
+
+		if enc := resp.Header.Get("Content-Encoding"); enc != tc.enc {
+			t.Fatalf("%q: expected %q, got %q", tc.accept, tc.enc, enc)
+		}
+
+		if resp.Header.Get("Vary") != "Accept-Encoding" {
+			t.Fatalf("%q: missing vary header: %v", tc.accept, resp.Header)
+		}
+
+		if !bytes.Contains(b, []byte(strings.Repeat("x", 1024))) {
+			t.Fatalf("%q: unexpected body: %s", tc.accept, b)
+		}
+	}
+}
+
+func TestCompressionEventStream(t *testing.T) {
+	for name, mw := range map[string]Handler{
+		"gzip":        Gzip(6),
+		"compression": Compression(CompressionOptions{}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := New(SetErrLogger(nil))
+			srv.Use(mw)
+
+			release := make(chan struct{})
+			srv.GET("/events", func(ctx *Context) Response {
+				ctx.SetContentType("text/event-stream")
+				ctx.Write([]byte("data: 1\n\n"))
+				ctx.Flush()
+				<-release
+				return Break
+			})
+
+			srv.GET("/disabled", func(ctx *Context) Response {
+				ctx.DisableCompression()
+				return NewJSONResponse(strings.Repeat("x", 1024))
+			})
+
+			ts := httptest.NewServer(srv)
+			defer ts.Close()
+			defer close(release)
+
+			req, _ := http.NewRequest(http.MethodGet, ts.URL+"/events", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			resp, err := http.DefaultTransport.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if enc := resp.Header.Get("Content-Encoding"); enc != "" {
+				t.Fatalf("unexpected encoding: %q", enc)
+			}
+
+			// the handler is still running, so the event must've been flushed as-is
+			b := make([]byte, 9)
+			if _, err := io.ReadFull(resp.Body, b); err != nil || string(b) != "data: 1\n\n" {
+				t.Fatalf("unexpected event %q: %v", b, err)
+			}
+
+			req, _ = http.NewRequest(http.MethodGet, ts.URL+"/disabled", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			if resp, err = http.DefaultTransport.RoundTrip(req); err != nil {
+				t.Fatal(err)
+			}
+			b, _ = io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if enc := resp.Header.Get("Content-Encoding"); enc != "" {
+				t.Fatalf("unexpected encoding: %q", enc)
+			}
+
+			if !bytes.Contains(b, []byte(strings.Repeat("x", 1024))) {
+				t.Fatalf("unexpected body: %s", b)
+			}
+		})
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	var enabled int32
+	srv := New(SetErrLogger(nil))
+	srv.Use(Maintenance(&enabled, 1500*time.Millisecond, "/health"))
+	srv.GET("/", func(ctx *Context) Response { return RespOK })
+	srv.GET("/health", func(ctx *Context) Response { return RespOK })
+
+	do := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	if w := do("/"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	atomic.StoreInt32(&enabled, 1)
+	if w := do("/"); w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "2" {
+		t.Fatalf("unexpected response: %d %v", w.Code, w.Header())
+	}
+
+	if w := do("/health"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+}
+
+func TestIdempotency(t *testing.T) {
+	var calls int32
+	srv := New(SetErrLogger(nil))
+	srv.Use(Idempotency(NewMemoryIdempotencyStore(time.Minute)))
+	srv.POST("/pay", func(ctx *Context) Response {
+		n := atomic.AddInt32(&calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		ctx.Header().Set("X-Call", "1")
+		return &JSONResponse{Code: http.StatusCreated, Data: n}
+	})
+
+	do := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/pay", nil)
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+
+	var (
+		wg   sync.WaitGroup
+		resp [4]*httptest.ResponseRecorder
+	)
+	for i := range resp {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp[i] = do("key-1")
+		}(i)
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("expected 1 call, got %d", n)
+	}
+
+	replayed := 0
+	for _, w := range resp {
+		if w.Code != http.StatusCreated || w.Header().Get("X-Call") != "1" || w.Body.String() != resp[0].Body.String() {
+			t.Fatalf("unexpected response: %d %v %s", w.Code, w.Header(), w.Body.String())
+		}
+		if w.Header().Get("Idempotent-Replayed") != "" {
+			replayed++
+		}
+	}
+
+	if replayed != len(resp)-1 {
+		t.Fatalf("expected %d replayed responses, got %d", len(resp)-1, replayed)
+	}
+
+	do("key-2")
+	do("")
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Fatalf("expected 3 calls, got %d", n)
+	}
+}
+
+func TestCacheBody(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.Use(CacheBody(16))
+	srv.Use(func(ctx *Context) Response {
+		if b, err := ctx.RawBody(); err != nil || string(b) != `{"a":1}` {
+			return NewJSONErrorResponse(http.StatusBadRequest, "unexpected raw body")
+		}
+		return nil
+	})
+
+	srv.POST("/", func(ctx *Context) Response {
+		var m map[string]int
+		if err := ctx.BindJSON(&m); err != nil {
+			return NewJSONErrorResponse(http.StatusBadRequest, err)
+		}
+		// BindJSON closes the body, which rewinds it
+		b, _ := io.ReadAll(ctx.Req.Body)
+		return NewJSONResponse(string(b))
+	})
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"a":1}`)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"{\"a\":1}"`) {
+		t.Fatalf("unexpected response: %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Repeat("x", 17))))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d", w.Code)
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	secret := []byte("s3cr3t")
+	sign := func(payload string) string {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(payload))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	srv := New(SetErrLogger(nil))
+	srv.POST("/hook", VerifySignature(SignatureOptions{Header: "X-Hub-Signature", Prefix: "sha256=", Secret: secret}),
+		func(ctx *Context) Response {
+			var m M
+			if err := ctx.BindJSON(&m); err != nil {
+				return NewJSONErrorResponse(http.StatusBadRequest, err)
+			}
+			return NewJSONResponse(m)
+		})
+
+	srv.POST("/ts", VerifySignature(SignatureOptions{
+		Secret: secret, TimestampHeader: "X-Timestamp", Tolerance: time.Minute,
+	}), func(ctx *Context) Response { return RespOK })
+
+	// a SecretFunc returning an empty key must not accept signatures made with an empty key
+	srv.POST("/nokey", VerifySignature(SignatureOptions{
+		SecretFunc: func(*Context) ([]byte, error) { return nil, nil },
+	}), func(ctx *Context) Response { return RespOK })
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	body := `{"a":1}`
+
+	emptyMac := hmac.New(sha256.New, nil)
+	emptyMac.Write([]byte(body))
+
+	tests := []struct {
+		path    string
+		headers map[string]string
+		code    int
+	}{
+		{"/hook", map[string]string{"X-Hub-Signature": sign(body)}, http.StatusOK},
+		{"/hook", map[string]string{"X-Hub-Signature": sign(body + " ")}, http.StatusUnauthorized},
+		{"/hook", nil, http.StatusUnauthorized},
+		{"/ts", map[string]string{"X-Signature": sign(now + "." + body)[7:], "X-Timestamp": now}, http.StatusOK},
+		{"/ts", map[string]string{"X-Signature": sign(old + "." + body)[7:], "X-Timestamp": old}, http.StatusUnauthorized},
+		{"/ts", map[string]string{"X-Signature": sign(body)[7:]}, http.StatusUnauthorized},
+		{"/nokey", map[string]string{"X-Signature": hex.EncodeToString(emptyMac.Sum(nil))}, http.StatusUnauthorized},
+	}
+
+	for i, tc := range tests {
+		req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(body))
+		for k, v := range tc.headers {
+			req.Header.Set(k, v)
+		}
+
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Fatalf("%d: expected %d, got %d: %s", i, tc.code, w.Code, w.Body.String())
+		}
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected a panic without a Secret or a SecretFunc")
+			}
+		}()
+		VerifySignature(SignatureOptions{})
+	}()
+}
+
+func TestDecompressRequest(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.Use(DecompressRequest(64))
+	srv.POST("/", func(ctx *Context) Response {
+		var m M
+		if err := ctx.BindJSON(&m); err != nil {
+			if err == ErrBodyTooLarge {
+				return NewJSONErrorResponse(http.StatusRequestEntityTooLarge)
+			}
+			return NewJSONErrorResponse(http.StatusBadRequest, err)
+		}
+		return NewJSONResponse(m)
+	})
+
+	compress := func(enc, s string) io.Reader {
+		var buf bytes.Buffer
+		var w io.WriteCloser
+		if enc == "gzip" {
+			w = gzip.NewWriter(&buf)
+		} else {
+			w = zlib.NewWriter(&buf)
+		}
+		w.Write([]byte(s))
+		w.Close()
+		return &buf
+	}
+
+	tests := []struct {
+		enc  string
+		body io.Reader
+		code int
+	}{
+		{"gzip", compress("gzip", `{"a":1}`), http.StatusOK},
+		{"deflate", compress("deflate", `{"a":1}`), http.StatusOK},
+		{"", strings.NewReader(`{"a":1}`), http.StatusOK},
+		{"gzip", strings.NewReader("not gzip"), http.StatusBadRequest},
+		{"gzip", compress("gzip", `{"a":"`+strings.Repeat("x", 128)+`"}`), http.StatusRequestEntityTooLarge},
+		{"br", strings.NewReader("x"), http.StatusUnsupportedMediaType},
+	}
+
+	for i, tc := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/", tc.body)
+		req.Header.Set("Content-Encoding", tc.enc)
+
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Fatalf("%d: expected %d, got %d: %s", i, tc.code, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	var calls int32
+	srv := New(SetErrLogger(nil))
+	srv.Use(Cache(time.Minute, CacheOptions{Vary: []string{"Accept-Language"}}))
+	srv.GET("/data", func(ctx *Context) Response {
+		n := atomic.AddInt32(&calls, 1)
+		ctx.Header().Set("X-Call", strconv.Itoa(int(n)))
+		return NewJSONResponse(n)
+	})
+	srv.GET("/fail", func(ctx *Context) Response {
+		atomic.AddInt32(&calls, 1)
+		return RespNotFound
+	})
+	srv.GET("/login", func(ctx *Context) Response {
+		n := atomic.AddInt32(&calls, 1)
+		http.SetCookie(ctx, &http.Cookie{Name: "session", Value: strconv.Itoa(int(n))})
+		return RespOK
+	})
+	srv.GET("/private", func(ctx *Context) Response {
+		atomic.AddInt32(&calls, 1)
+		ctx.SetCacheControl(CacheControl{Private: true})
+		return RespOK
+	})
+
+	do := func(method, path, lang string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Accept-Language", lang)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+
+	first := do(http.MethodGet, "/data", "en")
+	if first.Header().Get("Age") != "" {
+		t.Fatal("the first response shouldn't be cached")
+	}
+
+	second := do(http.MethodGet, "/data", "en")
+	if second.Header().Get("Age") != "0" || second.Header().Get("X-Call") != "1" || second.Body.String() != first.Body.String() {
+		t.Fatalf("expected a cached response: %v %s", second.Header(), second.Body.String())
+	}
+
+	if w := do(http.MethodHead, "/data", "en"); w.Header().Get("X-Call") != "1" {
+		t.Fatalf("expected a cached response: %v", w.Header())
+	}
+
+	if w := do(http.MethodGet, "/data", "fr"); w.Header().Get("X-Call") != "2" {
+		t.Fatalf("expected a new response: %v", w.Header())
+	}
+
+	do(http.MethodGet, "/fail", "")
+	do(http.MethodGet, "/fail", "")
+
+	// responses that set cookies or are private must not be shared
+	do(http.MethodGet, "/login", "")
+	if w := do(http.MethodGet, "/login", ""); w.Header().Get("Age") != "" || w.Header().Get("Set-Cookie") != "session=6" {
+		t.Fatalf("expected a new response: %v", w.Header())
+	}
+
+	do(http.MethodGet, "/private", "")
+	do(http.MethodGet, "/private", "")
+
+	if n := atomic.LoadInt32(&calls); n != 8 {
+		t.Fatalf("expected 8 calls, got %d", n)
+	}
+}
+
+func TestLRUCacheStore(t *testing.T) {
+	s := NewLRUCacheStore(2)
+	s.Set("a", &CachedResponse{Status: 1}, time.Minute)
+	s.Set("b", &CachedResponse{Status: 2}, time.Minute)
+	s.Get("a")
+	s.Set("c", &CachedResponse{Status: 3}, time.Minute)
+
+	if _, ok := s.Get("b"); ok {
+		t.Fatal("b should've been evicted")
+	}
+
+	if r, ok := s.Get("a"); !ok || r.Status != 1 {
+		t.Fatal("a should've been kept")
+	}
+
+	s.Set("d", &CachedResponse{Status: 4}, -time.Second)
+	if _, ok := s.Get("d"); ok {
+		t.Fatal("d should've expired")
+	}
+}
+
+func TestForceHTTPS(t *testing.T) {
+	srv := New(SetErrLogger(nil), TrustedProxies("10.0.0.1"))
+	srv.Use(ForceHTTPS(HTTPSOptions{
+		HSTSMaxAge:            time.Hour,
+		HSTSIncludeSubdomains: true,
+		ExemptPaths:           []string{"/.well-known/acme-challenge/"},
+	}))
+	h := func(ctx *Context) Response { return RespOK }
+	srv.GET("/*path", h)
+	srv.POST("/submit", h)
+
+	tests := []struct {
+		method, url, remote, proto string
+		code                       int
+		loc, hsts                  string
+	}{
+		{"GET", "http://example.com:8080/a?b=1", "1.2.3.4:1", "", http.StatusMovedPermanently, "https://example.com/a?b=1", ""},
+		{"POST", "http://example.com/submit", "1.2.3.4:1", "", http.StatusPermanentRedirect, "https://example.com/submit", ""},
+		{"GET", "http://example.com/a", "1.2.3.4:1", "https", http.StatusMovedPermanently, "https://example.com/a", ""},
+		{"GET", "http://example.com/a", "10.0.0.1:1", "https", http.StatusOK, "", "max-age=3600; includeSubDomains"},
+		{"GET", "https://example.com/a", "1.2.3.4:1", "", http.StatusOK, "", "max-age=3600; includeSubDomains"},
+		{"GET", "http://example.com/.well-known/acme-challenge/x", "1.2.3.4:1", "", http.StatusOK, "", ""},
+	}
+
+	for i, tc := range tests {
+		req := httptest.NewRequest(tc.method, tc.url, nil)
+		req.RemoteAddr = tc.remote
+		if tc.proto != "" {
+			req.Header.Set("X-Forwarded-Proto", tc.proto)
+		}
+
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+
+		if w.Code != tc.code || w.Header().Get("Location") != tc.loc || w.Header().Get("Strict-Transport-Security") != tc.hsts {
+			t.Fatalf("%d: unexpected response: %d %v", i, w.Code, w.Header())
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	var timedOut, gone bool
+	s := New(SetErrLogger(nil))
+	s.Use(Timeout(20 * time.Millisecond))
+	s.GET("/slow", func(ctx *Context) Response {
+		<-ctx.Req.Context().Done()
+		timedOut, gone = ctx.TimedOut(), ctx.ClientGone()
+		return NewJSONErrorResponse(http.StatusInternalServerError, ctx.Req.Context().Err())
+	})
+	s.GET("/nil", func(ctx *Context) Response {
+		<-ctx.Req.Context().Done()
+		return nil
+	})
+	s.GET("/fast", func(ctx *Context) Response {
+		return RespOK
+	})
+
+	for path, code := range map[string]int{"/slow": http.StatusGatewayTimeout, "/nil": http.StatusGatewayTimeout, "/fast": http.StatusOK} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != code {
+			t.Fatalf("%s: expected %d, got %d", path, code, w.Code)
+		}
+	}
+
+	if !timedOut || gone {
+		t.Fatalf("expected a timeout, not a disconnect: %v %v", timedOut, gone)
+	}
+
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/slow", nil).WithContext(c))
+	if w.Body.Len() != 0 || timedOut || !gone {
+		t.Fatalf("expected nothing to be written for a gone client, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestBodyLogger(t *testing.T) {
+	var buf bytes.Buffer
+	s := New(SetErrLogger(log.New(&buf, "", 0)))
+	s.Use(BodyLogger(BodyLogOptions{MaxBytes: 128, Redact: []string{"password", "data.users.token"}}))
+	s.POST("/login", func(ctx *Context) Response {
+		var req struct{ User, Password string }
+		if err := ctx.BindJSON(&req); err != nil {
+			return NewJSONErrorResponse(http.StatusBadRequest, err)
+		}
+		return NewJSONResponse(M{"users": []M{{"name": req.User, "token": "t0k3n"}}})
+	})
+	s.GET("/big", func(ctx *Context) Response {
+		ctx.Write(bytes.Repeat([]byte("x"), 200))
+		return nil
+	})
+
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(`{"user":"bob","password":"hunter2"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected response: %d %s", w.Code, w.Body.String())
+	}
+
+	out := buf.String()
+	if strings.Contains(out, "hunter2") || strings.Contains(out, "t0k3n") {
+		t.Fatalf("secrets leaked: %s", out)
+	}
+
+	if !strings.Contains(out, `request body: {"password":"***","user":"bob"}`) ||
+		!strings.Contains(out, `"users":[{"name":"bob","token":"***"}]`) {
+		t.Fatalf("unexpected log: %s", out)
+	}
+
+	buf.Reset()
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/big", nil))
+	if out = buf.String(); !strings.Contains(out, strings.Repeat("x", 128)+"... (truncated, size: >128)") {
+		t.Fatalf("unexpected log: %s", out)
+	}
+}
+
+func TestErrorCollector(t *testing.T) {
+	var buf bytes.Buffer
+	s := New(SetErrLogger(log.New(&buf, "", 0)))
+	s.Use(ErrorCollector())
+	s.GET("/", func(ctx *Context) Response {
+		ctx.AddError(errors.New("cache write failed"))
+		ctx.AddError(nil)
+		ctx.AddError(errors.New("stats timeout"))
+		if len(ctx.Errors()) != 2 {
+			t.Errorf("unexpected errors: %v", ctx.Errors())
+		}
+		return RespOK
+	})
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	out := buf.String()
+	if w.Code != http.StatusOK || !strings.Contains(out, "[GET /] error 1/2: cache write failed") || !strings.Contains(out, "error 2/2: stats timeout") {
+		t.Fatalf("unexpected log: %s", out)
+	}
+}
@@ -2,13 +2,29 @@ package apiserv
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"syscall"
 	"testing"
+	"testing/fstest"
 	"time"
+
+	"github.com/missionMeteora/apiserv/router"
 )
 
 var testData = []struct {
@@ -91,7 +107,7 @@ func TestServer(t *testing.T) {
 
 	srv.StaticFile("/README.md", "./router/README.md")
 
-	srv.Group("/mw", func(ctx *Context) Response {
+	srv.Group("", "/mw", func(ctx *Context) Response {
 		ctx.Set("data", "test")
 		return nil
 	}).GET("/sub", func(ctx *Context) Response {
@@ -269,3 +285,2888 @@ func TestListenZero(t *testing.T) {
 	s := newServerAndWait(t, "")
 	defer s.Shutdown(0)
 }
+
+func TestJSONCodec(t *testing.T) {
+	var marshaled, unmarshaled int
+	SetJSONCodec(func(v interface{}) ([]byte, error) {
+		marshaled++
+		return json.Marshal(v)
+	}, func(data []byte, v interface{}) error {
+		unmarshaled++
+		return json.Unmarshal(data, v)
+	})
+	defer SetJSONCodec(nil, nil)
+
+	srv := New(SetErrLogger(nil))
+	srv.POST("/echo", func(ctx *Context) Response {
+		var m M
+		if err := ctx.BindJSON(&m); err != nil {
+			return NewJSONErrorResponse(http.StatusBadRequest, err)
+		}
+		return NewJSONResponse(m)
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/echo", MimeJSON, strings.NewReader(`{"a": "b"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m M
+	if _, err = ReadJSONResponse(resp.Body, &m); err != nil {
+		t.Fatal(err)
+	}
+
+	if m["a"] != "b" || marshaled != 1 || unmarshaled != 1 {
+		t.Fatalf("unexpected response (%d, %d): %v", marshaled, unmarshaled, m)
+	}
+}
+
+func TestBindJSONWithLimit(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.POST("/strict", func(ctx *Context) Response {
+		var req struct {
+			Ping string `json:"ping"`
+		}
+		if err := ctx.BindJSONWithLimit(&req, 32); err != nil {
+			return NewJSONErrorResponse(http.StatusBadRequest, err)
+		}
+		return NewJSONResponse(req.Ping)
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	tests := []struct {
+		body  string
+		field string
+		err   bool
+	}{
+		{`{"ping": "pong"}`, "", false},
+		{`{"ping": "pong", "pong": 1}`, "pong", true},
+		{`{"ping": "` + strings.Repeat("x", 64) + `"}`, "", true},
+	}
+
+	for _, tc := range tests {
+		resp, err := http.Post(ts.URL+"/strict", MimeJSON, strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var s string
+		r, err := ReadJSONResponse(resp.Body, &s)
+		if (err != nil) != tc.err {
+			t.Fatalf("%s: unexpected error: %v", tc.body, err)
+		}
+
+		if tc.field != "" && (len(r.Errors) != 1 || r.Errors[0].Field != tc.field) {
+			t.Fatalf("%s: expected field %q, got %+v", tc.body, tc.field, r.Errors)
+		}
+	}
+}
+
+func TestHealthChecks(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	dbErr := errors.New("db is down")
+
+	srv.AddHealthCheck("/healthz", func() error { return nil })
+	srv.AddHealthCheck("/broken", func() error { return dbErr })
+	srv.AddReadinessCheck("cache", func() error { return nil })
+	srv.AddReadinessCheck("db", func() error { return dbErr })
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	var out struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks"`
+	}
+
+	resp, err := http.Get(ts.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ReadJSONResponse(resp.Body, &out)
+	if err != nil || resp.StatusCode != http.StatusOK || out.Status != "ok" {
+		t.Fatalf("unexpected response (%d): %+v %v", resp.StatusCode, out, err)
+	}
+
+	resp, err = http.Get(ts.URL + "/broken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := ReadJSONResponse(resp.Body, nil)
+	if resp.StatusCode != http.StatusServiceUnavailable || err == nil || len(r.Errors) != 1 || r.Errors[0].Message != dbErr.Error() {
+		t.Fatalf("unexpected response (%d): %v", resp.StatusCode, err)
+	}
+
+	resp, err = http.Get(ts.URL + ReadinessPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ = ReadJSONResponse(resp.Body, &out)
+	if resp.StatusCode != http.StatusServiceUnavailable || out.Status != "error" ||
+		out.Checks["cache"] != "ok" || out.Checks["db"] != dbErr.Error() || len(r.Errors) != 1 || r.Errors[0].Field != "db" {
+		t.Fatalf("unexpected response (%d): %+v %+v", resp.StatusCode, out, r)
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "apiserv.sock")
+	s := New(SetErrLogger(nil))
+	s.GET("/ping", func(ctx *Context) Response {
+		return NewJSONResponse("pong")
+	})
+
+	go s.ListenUnix(fp)
+	for len(s.Addrs()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cli := http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", fp)
+			},
+		},
+	}
+
+	resp, err := cli.Get("http://unix/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out string
+	if _, err = ReadJSONResponse(resp.Body, &out); err != nil || out != "pong" {
+		t.Fatalf("unexpected response %q: %v", out, err)
+	}
+
+	cli.CloseIdleConnections()
+	if err = s.Shutdown(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = os.Stat(fp); !os.IsNotExist(err) {
+		t.Fatalf("expected the socket to be removed: %v", err)
+	}
+}
+
+func TestRedirectTrailingSlash(t *testing.T) {
+	srv := New(SetErrLogger(nil), RedirectTrailingSlash(true), RedirectFixedPath(true))
+	srv.GET("/users", func(ctx *Context) Response { return RespOK })
+	srv.POST("/users", func(ctx *Context) Response { return RespOK })
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	cli := http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	tests := []struct {
+		method, path string
+		code         int
+		loc          string
+	}{
+		{http.MethodGet, "/users", http.StatusOK, ""},
+		{http.MethodGet, "/users/?q=1", http.StatusMovedPermanently, "/users?q=1"},
+		{http.MethodPost, "/users/", http.StatusPermanentRedirect, "/users"},
+		{http.MethodGet, "/a/../users", http.StatusMovedPermanently, "/users"},
+		{http.MethodGet, "/nope/", http.StatusNotFound, ""},
+	}
+
+	for _, tc := range tests {
+		req, _ := http.NewRequest(tc.method, ts.URL+tc.path, nil)
+		resp, err := cli.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != tc.code || resp.Header.Get("Location") != tc.loc {
+			t.Fatalf("%s %s: unexpected response %d %q", tc.method, tc.path, resp.StatusCode, resp.Header.Get("Location"))
+		}
+	}
+}
+
+func TestCreatedResponse(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.POST("/users", func(ctx *Context) Response {
+		return NewCreatedResponse("id:1", "/users/1")
+	})
+	srv.PUT("/users", func(ctx *Context) Response {
+		return RespCreated("/users/2")
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/users", MimeJSON, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var s string
+	if _, err = ReadJSONResponse(resp.Body, &s); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("Location") != "/users/1" || s != "id:1" {
+		t.Fatalf("unexpected response (%d) %v: %q", resp.StatusCode, resp.Header, s)
+	}
+
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/users", nil)
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("Location") != "/users/2" {
+		t.Fatalf("unexpected response (%d) %v", resp.StatusCode, resp.Header)
+	}
+}
+
+func TestRespAccepted(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.POST("/jobs", func(ctx *Context) Response { return RespAccepted })
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	for i := 0; i < 2; i++ {
+		resp, err := http.Post(ts.URL+"/jobs", MimeJSON, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := ReadJSONResponse(resp.Body, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusAccepted || r.Code != http.StatusAccepted || !r.Success {
+			t.Fatalf("unexpected response (%d): %+v", resp.StatusCode, r)
+		}
+	}
+
+	if r := JSONResponse(RespAccepted.(staticJSONResp)); r.Success {
+		t.Fatal("RespAccepted was modified")
+	}
+}
+
+func TestMsgpack(t *testing.T) {
+	MsgpackMarshal = func(v interface{}) ([]byte, error) {
+		b, err := json.Marshal(v)
+		return append([]byte("msgpack:"), b...), err
+	}
+	defer func() { MsgpackMarshal = nil }()
+
+	srv := New(SetErrLogger(nil))
+	srv.GET("/ping", func(ctx *Context) Response {
+		return NewJSONResponse("pong")
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	for accept, msgpack := range map[string]bool{
+		MimeMsgpack:             true,
+		"application/x-msgpack": true,
+		"application/json, application/msgpack;q=0.5": false,
+		"application/msgpack;q=0":                     false,
+		"*/*":                                         false,
+		"":                                            false,
+	} {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/ping", nil)
+		req.Header.Set("Accept", accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if ct := resp.Header.Get("Content-Type"); (ct == MimeMsgpack) != msgpack ||
+			msgpack && string(b) != `msgpack:{"data":"pong","code":200,"success":true}` {
+			t.Fatalf("%q: unexpected response (%s): %s", accept, ct, b)
+		}
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.GET("/users/:id", func(ctx *Context) Response { return RespOK })
+	srv.PUT("/users/:id", func(ctx *Context) Response { return RespOK })
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/users/1", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != "GET, HEAD, PUT" {
+		t.Fatalf("unexpected response (%d): %v", resp.StatusCode, resp.Header)
+	}
+
+	req, _ = http.NewRequest(http.MethodDelete, ts.URL+"/nope", nil)
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unexpected response (%d): %v", resp.StatusCode, resp.Header)
+	}
+
+	// the Allow lookup must use the original path, not the one toggled for the trailing slash redirect
+	srv = New(SetErrLogger(nil), RedirectTrailingSlash(true))
+	srv.GET("/users", func(ctx *Context) Response { return RespOK })
+
+	for path, allow := range map[string]string{"/users": "GET, HEAD", "/users/": ""} {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+
+		if code := w.Code; (code == http.StatusMethodNotAllowed) != (allow != "") || w.Header().Get("Allow") != allow {
+			t.Fatalf("%s: unexpected response (%d): %v", path, code, w.Header())
+		}
+	}
+}
+
+func TestAttachment(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.GET("/report", func(ctx *Context) Response {
+		return Attachment("report.csv", "text/csv", strings.NewReader("a,b\n"))
+	})
+	readmeHandler := func(ctx *Context) Response {
+		f, err := os.Open("./router/README.md")
+		if err != nil {
+			return NewJSONErrorResponse(http.StatusInternalServerError, err)
+		}
+		defer f.Close()
+		ctx.Attachment("rÉadme.md", f)
+		return nil
+	}
+	srv.GET("/readme", readmeHandler)
+	srv.GET("/readme.gz", Gzip(6), readmeHandler)
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if cd := resp.Header.Get("Content-Disposition"); cd != `attachment; filename=report.csv` || string(b) != "a,b\n" {
+		t.Fatalf("unexpected response (%s): %q", cd, b)
+	}
+
+	readme, _ := ioutil.ReadFile("./router/README.md")
+	if resp, err = http.Get(ts.URL + "/readme"); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if cd := resp.Header.Get("Content-Disposition"); cd != `attachment; filename*=utf-8''r%C3%89adme.md` ||
+		resp.ContentLength != int64(len(readme)) {
+		t.Fatalf("unexpected response (%s): %d", cd, resp.ContentLength)
+	}
+
+	if resp, err = http.Get(ts.URL + "/readme.gz"); err != nil {
+		t.Fatal(err)
+	}
+	b, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if err != nil || !resp.Uncompressed || !bytes.Equal(b, readme) {
+		t.Fatalf("unexpected gzip response (%v, %v): %d/%d", err, resp.Uncompressed, len(b), len(readme))
+	}
+}
+
+func TestBind(t *testing.T) {
+	type req struct {
+		Name string   `json:"name" xml:"name"`
+		Age  int      `json:"age" xml:"age"`
+		Tags []string `form:"tag" json:"tags" xml:"tags"`
+	}
+
+	srv := New(SetErrLogger(nil))
+	srv.POST("/bind", func(ctx *Context) Response {
+		var r req
+		if err := ctx.Bind(&r); err == ErrUnsupportedContentType {
+			return NewJSONErrorResponse(http.StatusUnsupportedMediaType, err)
+		} else if err != nil {
+			return NewJSONErrorResponse(http.StatusBadRequest, err)
+		}
+		return NewJSONResponse(r)
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	tests := []struct {
+		ct, body string
+		code     int
+	}{
+		{"", `{"name": "x", "age": 1, "tags": ["a", "b"]}`, http.StatusOK},
+		{MimeJSON, `{"name": "x", "age": 1, "tags": ["a", "b"]}`, http.StatusOK},
+		{"application/x-www-form-urlencoded", `name=x&age=1&tag=a&tag=b`, http.StatusOK},
+		{MimeXML, `<req><name>x</name><age>1</age><tags>a</tags><tags>b</tags></req>`, http.StatusOK},
+		{"application/x-www-form-urlencoded", `name=x&age=y`, http.StatusBadRequest},
+		{MimePlain, `x`, http.StatusUnsupportedMediaType},
+	}
+
+	for _, tc := range tests {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/bind", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", tc.ct)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out M
+		ReadJSONResponse(resp.Body, &out)
+
+		if resp.StatusCode != tc.code {
+			t.Fatalf("%s: unexpected status %d", tc.ct, resp.StatusCode)
+		}
+
+		if tc.code == http.StatusOK && (out["name"] != "x" || out["age"] != 1.0 || len(out["tags"].([]interface{})) != 2) {
+			t.Fatalf("%s: unexpected response: %v", tc.ct, out)
+		}
+	}
+}
+
+func TestNotFoundHandler(t *testing.T) {
+	srv := New(SetErrLogger(nil), NotFoundHandler(func(ctx *Context) Response {
+		if strings.HasPrefix(ctx.Path(), "/api/") {
+			return RespNotFound
+		}
+		return SimpleResponse(http.StatusNotFound, MimeHTML, "<h1>"+ctx.Get("mw").(string)+"</h1>")
+	}))
+	srv.Use(func(ctx *Context) Response {
+		ctx.Set("mw", "not found")
+		return nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	for path, body := range map[string]string{
+		"/api/nope": `{"errors":[{"message":"Not Found"}],"code":404,"success":false}` + "\n",
+		"/nope":     "<h1>not found</h1>",
+	} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNotFound || string(b) != body {
+			t.Fatalf("%s: unexpected response (%d): %s", path, resp.StatusCode, b)
+		}
+	}
+
+	// the deprecated field takes precedence over the option
+	srv.NotFoundHandler = func(ctx *Context) { ctx.Write([]byte("field")) }
+	resp, err := http.Get(ts.URL + "/nope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(b) != "field" {
+		t.Fatalf("unexpected response: %s", b)
+	}
+}
+
+func TestJSONStream(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.GET("/stream/:fail", func(ctx *Context) Response {
+		enc, err := ctx.JSONStream()
+		if err != nil {
+			return NewJSONErrorResponse(http.StatusInternalServerError, err)
+		}
+		defer enc.Close()
+
+		for i := 0; i < 3; i++ {
+			enc.Encode(i)
+		}
+
+		if ctx.Param("fail") == "1" {
+			enc.AddError(errors.New("cursor error"))
+		}
+		return nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	for _, fail := range []string{"0", "1"} {
+		resp, err := http.Get(ts.URL + "/stream/" + fail)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var data []int
+		r, err := ReadJSONResponse(resp.Body, &data)
+
+		switch {
+		case len(data) != 3 || data[2] != 2:
+			t.Fatalf("unexpected data: %v", data)
+		case fail == "0" && (err != nil || resp.StatusCode != http.StatusOK):
+			t.Fatalf("unexpected response (%d): %v", resp.StatusCode, err)
+		case fail == "1" && (err == nil || resp.StatusCode != http.StatusInternalServerError || len(r.Errors) != 1):
+			t.Fatalf("unexpected response (%d): %+v", resp.StatusCode, r)
+		}
+	}
+
+	// streams always use the default envelope
+	srv = New(SetErrLogger(nil), JSONEnvelope(func(r *JSONResponse) interface{} {
+		return M{"result": r.Data}
+	}))
+	srv.GET("/stream", func(ctx *Context) Response {
+		enc, _ := ctx.JSONStream()
+		enc.Encode(1)
+		enc.Close()
+		return nil
+	})
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	if b := strings.TrimSpace(w.Body.String()); b != `{"data":[1],"code":200,"success":true}` {
+		t.Fatalf("unexpected stream: %s", b)
+	}
+}
+
+func TestSetKeepAlivesEnabled(t *testing.T) {
+	s := New(SetErrLogger(nil))
+	s.GET("/ping", func(ctx *Context) Response { return RespOK })
+	s.SetKeepAlivesEnabled(false)
+
+	go s.Run("127.0.0.1:0")
+	defer s.Shutdown(0)
+
+	for len(s.Addrs()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	resp, err := http.Get("http://" + s.Addrs()[0] + "/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if !resp.Close {
+		t.Fatal("expected the connection to be closed")
+	}
+}
+
+func TestOnResponse(t *testing.T) {
+	type result struct{ status, bytes int }
+	ch := make(chan []result, 1)
+
+	srv := New(SetErrLogger(nil))
+	srv.Use(func(ctx *Context) Response {
+		var res []result
+		ctx.OnResponse(func(status, bytes int) { res = append(res, result{status, bytes}) })
+		ctx.OnResponse(func(status, bytes int) { ch <- append(res, result{status, bytes}) })
+		return nil
+	})
+	srv.GET("/ping", func(ctx *Context) Response {
+		return PlainResponse(MimePlain, "pong")
+	})
+	srv.GET("/panic", func(ctx *Context) Response {
+		panic("boom")
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	for path, exp := range map[string]result{
+		"/ping":  {http.StatusOK, 4},
+		"/panic": {http.StatusInternalServerError, 75}, // the panic response is written through the same ctx
+	} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if res := <-ch; len(res) != 2 || res[0] != exp || res[1] != exp {
+			t.Fatalf("%s: expected %v, got %v", path, exp, res)
+		}
+	}
+}
+
+func TestTypedParams(t *testing.T) {
+	ctx := &Context{Params: router.Params{
+		{Name: "id", Value: "42"},
+		{Name: "bad", Value: "x"},
+		{Name: "ok", Value: "true"},
+		{Name: "uuid", Value: "123e4567-e89b-12d3-a456-426614174000"},
+	}}
+
+	if n, err := ctx.ParamInt("id"); err != nil || n != 42 {
+		t.Fatalf("unexpected ParamInt: %v %v", n, err)
+	}
+
+	if b, err := ctx.ParamBool("ok"); err != nil || !b {
+		t.Fatalf("unexpected ParamBool: %v %v", b, err)
+	}
+
+	if _, err := ctx.ParamUUID("uuid"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ctx.ParamUUID("id"); err == nil || err.(*Error).Field != "id" {
+		t.Fatalf("expected an error, got %v", err)
+	}
+
+	if _, err := ctx.ParamInt64("missing"); err == nil || !err.(*Error).IsMissing {
+		t.Fatalf("expected a missing error, got %v", err)
+	}
+
+	if _, r := ctx.MustParamInt("bad"); r == nil || r.(*JSONResponse).Code != http.StatusBadRequest {
+		t.Fatalf("expected a 400 response, got %v", r)
+	}
+}
+
+func TestMount(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users", func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, req.Method+" "+req.URL.Path)
+	})
+
+	srv := New(SetErrLogger(nil))
+	if err := srv.Mount("/admin/", mux); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/admin/users", MimePlain, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(b) != "POST /users" {
+		t.Fatalf("unexpected response: %s", b)
+	}
+}
+
+func TestJSONEnvelope(t *testing.T) {
+	srv := New(SetErrLogger(nil), JSONEnvelope(func(r *JSONResponse) interface{} {
+		return M{"result": r.Data, "err": r.Errors}
+	}))
+	srv.GET("/ping", func(ctx *Context) Response {
+		return NewJSONResponse("pong")
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	for path, exp := range map[string]string{
+		"/ping": `{"err":null,"result":"pong"}`,
+		"/nope": `{"err":[{"message":"Not Found"}],"result":null}`,
+	} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if string(bytes.TrimSpace(b)) != exp {
+			t.Fatalf("%s: unexpected response: %s", path, b)
+		}
+	}
+}
+
+func TestMaxURILength(t *testing.T) {
+	srv := New(SetErrLogger(nil), MaxURILength(32))
+	srv.GET("/ping", func(ctx *Context) Response {
+		return NewJSONResponse("pong")
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	for path, code := range map[string]int{
+		"/ping":                              http.StatusOK,
+		"/ping?q=" + strings.Repeat("x", 32): http.StatusRequestURITooLong,
+	} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != code {
+			t.Fatalf("%s: expected %d, got %d", path, code, resp.StatusCode)
+		}
+	}
+}
+
+func TestCtxError(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.GET("/err/:n", func(ctx *Context) Response {
+		switch ctx.Param("n") {
+		case "1":
+			return ctx.Error(http.StatusNotFound, "user not found")
+		case "2":
+			return ctx.JSONError(http.StatusConflict, errors.New("a"), &Error{Message: "b", Field: "f"})
+		default:
+			return ctx.Error(http.StatusTeapot)
+		}
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	for path, exp := range map[string]string{
+		"/err/1": `{"errors":[{"message":"user not found"}],"code":404,"success":false}`,
+		"/err/2": `{"errors":[{"message":"a"},{"message":"b","field":"f"}],"code":409,"success":false}`,
+		"/err/3": `{"errors":[{"message":"I'm a teapot"}],"code":418,"success":false}`,
+	} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if string(bytes.TrimSpace(b)) != exp {
+			t.Fatalf("%s: unexpected response: %s", path, b)
+		}
+	}
+}
+
+func TestCheckPrecondition(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	h := func(ctx *Context) Response {
+		if v := ctx.Query("v"); v != "" {
+			ctx.SetETag(v)
+		}
+		if ok, code := ctx.CheckPrecondition(); !ok {
+			return ctx.Error(code)
+		}
+		return RespOK
+	}
+	srv.GET("/r", h)
+	srv.PUT("/r", h)
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		method, path, hdr, val string
+		code                   int
+	}{
+		{"PUT", "/r?v=1", "If-Match", `"1"`, http.StatusOK},
+		{"PUT", "/r?v=1", "If-Match", `"0", "1"`, http.StatusOK},
+		{"PUT", "/r?v=2", "If-Match", `"1"`, http.StatusPreconditionFailed},
+		{"PUT", "/r?v=W/\"1\"", "If-Match", `W/"1"`, http.StatusPreconditionFailed},
+		{"PUT", "/r", "If-Match", `*`, http.StatusPreconditionFailed},
+		{"PUT", "/r", "If-None-Match", `*`, http.StatusOK},
+		{"PUT", "/r?v=1", "If-None-Match", `*`, http.StatusPreconditionFailed},
+		{"GET", "/r?v=1", "If-None-Match", `W/"1"`, http.StatusNotModified},
+		{"GET", "/r?v=2", "If-None-Match", `"1"`, http.StatusOK},
+	} {
+		req, _ := http.NewRequest(tc.method, ts.URL+tc.path, nil)
+		req.Header.Set(tc.hdr, tc.val)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != tc.code {
+			t.Fatalf("%s %s %s: %s: expected %d, got %d", tc.method, tc.path, tc.hdr, tc.val, tc.code, resp.StatusCode)
+		}
+	}
+
+	// 304 responses can't have a body
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/r?v=1", nil)
+	req.Header.Set("If-None-Match", `"1"`)
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Fatalf("unexpected response (%d): %s", w.Code, w.Body)
+	}
+}
+
+type errWriter struct {
+	http.ResponseWriter
+	err error
+}
+
+func (w errWriter) Write([]byte) (int, error) { return 0, w.err }
+
+func TestClientGone(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		gone bool
+	}{
+		{&net.OpError{Op: "write", Err: os.NewSyscallError("write", syscall.EPIPE)}, true},
+		{fmt.Errorf("wrapped: %w", syscall.ECONNRESET), true},
+		{errors.New("write tcp: broken pipe"), true},
+		{http.ErrBodyNotAllowed, false},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		ctx := &Context{Req: req, ResponseWriter: errWriter{httptest.NewRecorder(), tc.err}, data: M{}}
+		if _, err := ctx.Write([]byte("x")); err != tc.err {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if ctx.ClientGone() != tc.gone || IsClientDisconnect(tc.err) != tc.gone {
+			t.Fatalf("%v: expected %v", tc.err, tc.gone)
+		}
+	}
+
+	cctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ctx := &Context{Req: httptest.NewRequest(http.MethodGet, "/", nil).WithContext(cctx)}
+	if !ctx.ClientGone() {
+		t.Fatal("expected a canceled request to be gone")
+	}
+}
+
+func TestStreamJSONArray(t *testing.T) {
+	for _, tc := range []struct {
+		body   string
+		ndjson bool
+		exp    int
+		err    bool
+	}{
+		{`[{"n":1}, {"n":2}, {"n":100}, {"n":3}]`, false, 6, false},
+		{"{\"n\":1}\n{\"n\":2}\n{\"n\":100}\n", true, 3, false},
+		{`{"n":1}`, false, 0, true},
+		{`[{"n":1}, {"n":"x"}]`, false, 0, true},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+		ctx := &Context{Req: req, data: M{}}
+
+		var sum, idx int
+		fn := func(decode func(v interface{}) error) error {
+			if idx++; idx == 3 {
+				return nil // skipped
+			}
+			var v struct{ N int }
+			if err := decode(&v); err != nil {
+				return err
+			}
+			sum += v.N
+			return nil
+		}
+
+		var err error
+		if tc.ndjson {
+			err = ctx.StreamNDJSON(fn)
+		} else {
+			err = ctx.StreamJSONArray(fn)
+		}
+
+		if (err != nil) != tc.err {
+			t.Fatalf("%s: unexpected error: %v", tc.body, err)
+		}
+
+		if !tc.err && sum != tc.exp {
+			t.Fatalf("%s: expected %d, got %d", tc.body, tc.exp, sum)
+		}
+	}
+}
+
+func TestReadHeaderTimeout(t *testing.T) {
+	srv := New(SetErrLogger(nil), ReadHeaderTimeout(time.Second), ReadTimeout(time.Minute))
+	if hs := srv.newHTTPServer(""); hs.ReadHeaderTimeout != time.Second || hs.ReadTimeout != time.Minute {
+		t.Fatalf("unexpected timeouts: %v %v", hs.ReadHeaderTimeout, hs.ReadTimeout)
+	}
+}
+
+func TestWildcard(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.GET("/files/:bucket/*fp", func(ctx *Context) Response {
+		fp, err := ctx.WildcardPath()
+		if err != nil {
+			return ctx.Error(http.StatusBadRequest, err)
+		}
+		return NewJSONResponse(ctx.Wildcard() + "|" + fp)
+	})
+	srv.GET("/users/:id", func(ctx *Context) Response {
+		return NewJSONResponse(ctx.Wildcard() + "|" + ctx.Param("id"))
+	})
+
+	c := func(path string) (*JSONResponse, int) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.URL.Path = path // bypass client side cleaning
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+
+		var r JSONResponse
+		json.NewDecoder(rec.Body).Decode(&r)
+		return &r, rec.Code
+	}
+
+	for path, exp := range map[string]string{
+		"/files/b/a/b.txt": "a/b.txt|a/b.txt",
+		"/files/b/a//./b":  "a/b|a/b",
+		"/users/42":        "|42",
+	} {
+		r, code := c(path)
+		if code != http.StatusOK || r.Data != exp {
+			t.Fatalf("%s: expected %s, got %+v", path, exp, r)
+		}
+	}
+
+	ctx := &Context{Params: router.Params{{Name: "fp", Value: "/x/../../etc/passwd"}}, star: "fp"}
+	if _, err := ctx.WildcardPath(); err != ErrPathTraversal {
+		t.Fatalf("expected ErrPathTraversal, got %v", err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.GET("/csv", func(ctx *Context) Response {
+		var n int
+		ctx.Stream("text/csv", func(w io.Writer) bool {
+			n++
+			fmt.Fprintf(w, "%d,%d\n", n, n*n)
+			return n < 3
+		})
+		return RespOK // ignored, ctx is done
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/csv" || string(b) != "1,1\n2,4\n3,9\n" {
+		t.Fatalf("unexpected response (%s): %q", ct, b)
+	}
+
+	cctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ctx := &Context{Req: httptest.NewRequest(http.MethodGet, "/", nil).WithContext(cctx), ResponseWriter: httptest.NewRecorder()}
+	if err := ctx.Stream(MimePlain, func(io.Writer) bool { return true }); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestJSONDecodeErrors(t *testing.T) {
+	type user struct {
+		Name    string
+		Profile struct {
+			Age int `json:"age"`
+		} `json:"profile"`
+	}
+
+	bind := func(body string) error {
+		ctx := &Context{Req: httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))}
+		var u user
+		return ctx.BindJSON(&u)
+	}
+
+	if err := bind(" \n"); err != ErrEmptyBody {
+		t.Fatalf("expected ErrEmptyBody, got %v", err)
+	}
+
+	if err := bind(`{"Name": `); !IsJSONSyntaxError(err) {
+		t.Fatalf("expected a syntax error, got %v", err)
+	}
+
+	err := bind(`{"profile": {"age": "x"}}`)
+	if field, ok := IsJSONTypeError(err); !ok || field != "profile.age" {
+		t.Fatalf("expected a type error for profile.age, got %q %v", field, err)
+	}
+
+	if IsJSONSyntaxError(err) {
+		t.Fatalf("unexpected syntax error: %v", err)
+	}
+
+	ctx := &Context{
+		Req:            httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"profile": {"age": "x"}}`)),
+		ResponseWriter: httptest.NewRecorder(),
+	}
+	var u user
+	if r := ctx.MustBindJSON(&u).(*JSONResponse); len(r.Errors) != 1 || r.Errors[0].Field != "profile.age" {
+		t.Fatalf("unexpected response: %+v", r)
+	}
+}
+
+func TestNamedRoutes(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	h := func(ctx *Context) Response { return RespOK }
+
+	if err := srv.AddNamedRoute("user", http.MethodGet, "/users/:id", h); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.AddNamedRoute("user", http.MethodPut, "/users/:id", h); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.AddNamedRoute("user", http.MethodGet, "/u/:id", h); err != ErrDuplicateRoute {
+		t.Fatalf("expected ErrDuplicateRoute, got %v", err)
+	}
+
+	// a route that fails to register must not keep its name
+	bad := New(SetErrLogger(nil), SetRouterOptions(&router.Options{NoPanicOnInvalidAddRoute: true}))
+	if err := bad.AddNamedRoute("bad", http.MethodGet, "/bad/*a/*b", h); err != router.ErrTooManyStars {
+		t.Fatalf("expected ErrTooManyStars, got %v", err)
+	}
+	if _, err := bad.URL("bad"); err != ErrUnknownRoute {
+		t.Fatalf("expected ErrUnknownRoute, got %v", err)
+	}
+
+	g := srv.Group("", "/files")
+	if err := g.AddNamedRoute("file", http.MethodGet, "/:bucket/*fp", h); err != nil {
+		t.Fatal(err)
+	}
+
+	if u, err := srv.URL("user", "id", "a b/c"); err != nil || u != "/users/a%20b%2Fc" {
+		t.Fatalf("unexpected url: %q %v", u, err)
+	}
+
+	if u, err := srv.URL("file", "bucket", "b", "fp", "/x/y z.txt"); err != nil || u != "/files/b/x/y%20z.txt" {
+		t.Fatalf("unexpected url: %q %v", u, err)
+	}
+
+	if _, err := srv.URL("file", "bucket", "b"); err == nil || err.(*Error).Field != "fp" {
+		t.Fatalf("expected a missing param error, got %v", err)
+	}
+
+	if _, err := srv.URL("nope"); err != ErrUnknownRoute {
+		t.Fatalf("expected ErrUnknownRoute, got %v", err)
+	}
+}
+
+func TestSetStatus(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.Use(func(ctx *Context) Response {
+		if ctx.Req.Method == http.MethodPost {
+			ctx.SetStatus(http.StatusCreated)
+		}
+		return nil
+	})
+	srv.POST("/ok", func(ctx *Context) Response { return RespOK })
+	srv.POST("/err", func(ctx *Context) Response { return RespBadRequest })
+	srv.POST("/plain", func(ctx *Context) Response { return PlainResponse(MimePlain, "x") })
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	for path, code := range map[string]int{
+		"/ok":    http.StatusCreated,
+		"/err":   http.StatusBadRequest,
+		"/plain": http.StatusCreated,
+	} {
+		resp, err := http.Post(ts.URL+path, MimeJSON, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != code {
+			t.Fatalf("%s: expected %d, got %d: %s", path, code, resp.StatusCode, b)
+		}
+
+		if path == "/ok" && !bytes.Contains(b, []byte(`"code":201`)) {
+			t.Fatalf("unexpected body: %s", b)
+		}
+	}
+
+	if RespOK.(*JSONResponse).Code != http.StatusOK {
+		t.Fatal("RespOK was modified")
+	}
+}
+
+func TestRoutesInfo(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	h := func(ctx *Context) Response { return RespOK }
+
+	srv.AddNamedRoute("user", http.MethodGet, "/users/:id", h)
+	srv.POST("/users", h)
+	srv.Group("api", "/api").GET("/:id", h)
+	srv.Static("/s", ".", false)
+	srv.Describe(http.MethodGet, "/users/:id", "returns a user")
+
+	exp := []RouteInfo{
+		{Group: "api", Method: "GET", Pattern: "/api/:id", Params: []string{":id"}, Handlers: 1},
+		{Method: "GET", Pattern: "/s/*fp", Params: []string{"*fp"}, Handlers: 1},
+		{Method: "POST", Pattern: "/users", Handlers: 1},
+		{Method: "GET", Pattern: "/users/:id", Name: "user", Description: "returns a user", Params: []string{":id"}, Handlers: 1},
+	}
+
+	if ri := srv.RoutesInfo(); !reflect.DeepEqual(ri, exp) {
+		t.Fatalf("unexpected routes:\n%+v\n%+v", ri, exp)
+	}
+}
+
+func TestCtxLogf(t *testing.T) {
+	var buf bytes.Buffer
+	srv := New(SetErrLogger(log.New(&buf, "apiserv: ", 0)))
+	srv.Use(LogRequests(false))
+	srv.GET("/a%b", func(ctx *Context) Response {
+		ctx.Logf("hello %d", 1)
+		ctx.Logger().Print("world")
+		return RespOK
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/a%25b", nil)
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+
+	out := buf.String()
+	for _, exp := range []string{
+		"server_test.go:", "[reqID:00001] [GET /a%b] hello 1\n",
+		"apiserv: [reqID:00001] [GET /a%b] world\n",
+	} {
+		if !strings.Contains(out, exp) {
+			t.Fatalf("expected %q in:\n%s", exp, out)
+		}
+	}
+}
+
+func TestServeReader(t *testing.T) {
+	modtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	srv := New(SetErrLogger(nil))
+	srv.GET("/report.csv", func(ctx *Context) Response {
+		ctx.ServeReader("report.csv", modtime, strings.NewReader("0123456789"))
+		return RespOK // ignored
+	})
+
+	for _, tc := range []struct {
+		hdr, val string
+		code     int
+		body     string
+	}{
+		{"", "", http.StatusOK, "0123456789"},
+		{"Range", "bytes=2-4", http.StatusPartialContent, "234"},
+		{"If-Modified-Since", modtime.Format(http.TimeFormat), http.StatusNotModified, ""},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/report.csv", nil)
+		if tc.hdr != "" {
+			req.Header.Set(tc.hdr, tc.val)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+
+		if rec.Code != tc.code || rec.Body.String() != tc.body {
+			t.Fatalf("%s: unexpected response (%d): %q", tc.hdr, rec.Code, rec.Body.String())
+		}
+
+		if tc.code == http.StatusOK && !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/csv") {
+			t.Fatalf("unexpected content-type: %s", rec.Header().Get("Content-Type"))
+		}
+	}
+}
+
+type validatedUser struct {
+	Name string `json:"name" form:"name"`
+	Age  int    `json:"age" form:"age"`
+}
+
+func (u *validatedUser) Validate() error {
+	var me MultiError
+	if u.Name == "" {
+		me = append(me, &Error{Message: "name is required", Field: "name", IsMissing: true})
+	}
+	if u.Age < 0 {
+		me = append(me, &Error{Message: "age must be positive", Field: "age"})
+	}
+	if len(me) == 0 {
+		return nil
+	}
+	return me
+}
+
+func TestBindValidate(t *testing.T) {
+	newCtx := func(ct, body string) *Context {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set("Content-Type", ct)
+		return &Context{Req: req, ResponseWriter: httptest.NewRecorder()}
+	}
+
+	var u validatedUser
+	if err := newCtx(MimeJSON, `{"name": "x", "age": 1}`).Bind(&u); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := newCtx("application/x-www-form-urlencoded", "age=-1").Bind(&validatedUser{}); err == nil || len(err.(MultiError)) != 2 {
+		t.Fatalf("expected 2 errors, got %v", err)
+	}
+
+	r := newCtx(MimeJSON, `{"age": -1}`).MustBindJSON(&validatedUser{}).(*JSONResponse)
+	if len(r.Errors) != 2 || r.Errors[0].Field != "name" || r.Errors[1].Field != "age" {
+		t.Fatalf("unexpected response: %+v", r)
+	}
+
+	SetValidator(func(v interface{}) error {
+		if m, ok := v.(*M); ok && (*m)["id"] == nil {
+			return &Error{Message: "missing id", Field: "id", IsMissing: true}
+		}
+		return nil
+	})
+	defer SetValidator(nil)
+
+	if err := newCtx(MimeJSON, `{}`).BindJSON(&M{}); err == nil || err.(*Error).Field != "id" {
+		t.Fatalf("expected a missing id error, got %v", err)
+	}
+}
+
+func TestRunMany(t *testing.T) {
+	s := New(SetErrLogger(nil))
+	s.GET("/ping", func(ctx *Context) Response {
+		return NewJSONResponse("pong")
+	})
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.RunMany("127.0.0.1:0", "127.0.0.1:0") }()
+
+	for len(s.Addrs()) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	for _, addr := range s.Addrs() {
+		resp, err := http.Get("http://" + addr + "/ping")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: unexpected status: %d", addr, resp.StatusCode)
+		}
+	}
+
+	if err := s.RunMany("127.0.0.1:0", s.Addrs()[0]); err == nil {
+		t.Fatal("expected a listen error")
+	}
+
+	s.Shutdown(time.Second)
+
+	select {
+	case err := <-errCh:
+		if err != http.ErrServerClosed {
+			t.Fatalf("expected http.ErrServerClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("server didn't shutdown")
+	}
+}
+
+func TestRemainingTime(t *testing.T) {
+	ctx := &Context{Req: httptest.NewRequest(http.MethodGet, "/", nil)}
+	if d, ok := ctx.RemainingTime(); ok || d != 0 {
+		t.Fatalf("unexpected deadline: %v %v", d, ok)
+	}
+
+	cctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	ctx.Req = ctx.Req.WithContext(cctx)
+	if d, ok := ctx.RemainingTime(); !ok || d <= 0 || d > time.Minute {
+		t.Fatalf("unexpected deadline: %v %v", d, ok)
+	}
+
+	cctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	ctx.Req = ctx.Req.WithContext(cctx)
+	if d, ok := ctx.RemainingTime(); !ok || d != 0 {
+		t.Fatalf("unexpected deadline: %v %v", d, ok)
+	}
+}
+
+func TestJSONPCallback(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.GET("/jsonp", func(ctx *Context) Response {
+		return NewJSONPResponse(ctx.Query("callback"), 1)
+	})
+
+	get := func(cb string) string {
+		req := httptest.NewRequest(http.MethodGet, "/jsonp?callback="+url.QueryEscape(cb), nil)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	for cb, exp := range map[string]string{
+		"app.cb_1":             "app.cb_1(",
+		"$jq":                  "$jq(",
+		"alert(1);x":           "console.error(",
+		"1cb":                  "console.error(",
+		"</script><script>x()": "console.error(",
+	} {
+		if out := get(cb); !strings.HasPrefix(out, exp) {
+			t.Fatalf("%q: unexpected output: %s", cb, out)
+		}
+	}
+
+	SetJSONPCallbackValidator(func(cb string) bool { return cb == "allowed" })
+	defer SetJSONPCallbackValidator(nil)
+
+	if out := get("app.cb"); !strings.HasPrefix(out, "console.error(") {
+		t.Fatalf("unexpected output: %s", out)
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	ctx := &Context{
+		Req:    httptest.NewRequest(http.MethodGet, "/?limit=10&bad=x&empty=", nil),
+		Params: router.Params{{Name: "id", Value: "42"}, {Name: "empty"}},
+	}
+
+	if v := ctx.ParamDefault("id", "1"); v != "42" {
+		t.Fatalf("unexpected value: %s", v)
+	}
+
+	if v := ctx.ParamDefault("empty", "1"); v != "1" {
+		t.Fatalf("unexpected value: %s", v)
+	}
+
+	if v := ctx.QueryDefault("empty", "x"); v != "x" {
+		t.Fatalf("unexpected value: %s", v)
+	}
+
+	for key, exp := range map[string]int{"limit": 10, "bad": 25, "missing": 25} {
+		if n := ctx.QueryInt(key, 25); n != exp {
+			t.Fatalf("%s: expected %d, got %d", key, exp, n)
+		}
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	srv := New(SetErrLogger(nil), CleanPath(true))
+	srv.GET("/a/c", func(ctx *Context) Response { return RespOK })
+	srv.POST("/a/c", func(ctx *Context) Response { return NewJSONResponse(ctx.Path()) })
+	srv.GET("/s/*fp", func(ctx *Context) Response { return NewJSONResponse(ctx.Param("fp")) })
+
+	for _, tc := range []struct {
+		method, path string
+		code         int
+		loc          string
+	}{
+		{http.MethodGet, "/a//b/../c", http.StatusMovedPermanently, "/a/c"},
+		{http.MethodHead, "/a/./c", http.StatusMovedPermanently, "/a/c"},
+		{http.MethodPost, "/a//b/../c", http.StatusOK, ""},
+		{http.MethodGet, "/s/x/../y", http.StatusMovedPermanently, "/s/y"},
+	} {
+		req := httptest.NewRequest(tc.method, "/", nil)
+		req.URL.Path = tc.path
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+
+		if rec.Code != tc.code || rec.Header().Get("Location") != tc.loc {
+			t.Fatalf("%s %s: unexpected response %d %q", tc.method, tc.path, rec.Code, rec.Header().Get("Location"))
+		}
+
+		if tc.method == http.MethodPost && !strings.Contains(rec.Body.String(), `"/a/c"`) {
+			t.Fatalf("expected the path to be rewritten: %s", rec.Body.String())
+		}
+	}
+}
+
+type cancelWriter struct {
+	*httptest.ResponseRecorder
+	cancel func()
+}
+
+func (w cancelWriter) Write(p []byte) (int, error) {
+	w.cancel()
+	return w.ResponseRecorder.Write(p)
+}
+
+type closeTracker struct {
+	io.ReadSeekCloser
+	closed bool
+}
+
+func (c *closeTracker) Close() error {
+	c.closed = true
+	return c.ReadSeekCloser.Close()
+}
+
+func TestFileCancel(t *testing.T) {
+	const size = 1 << 20
+	fp := filepath.Join(t.TempDir(), "big.bin")
+	if err := ioutil.WriteFile(fp, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var tracker *closeTracker
+	origOpen := openFile
+	defer func() { openFile = origOpen }()
+	openFile = func(fp string) (io.ReadSeekCloser, os.FileInfo, error) {
+		f, fi, err := origOpen(fp)
+		tracker = &closeTracker{ReadSeekCloser: f}
+		return tracker, fi, err
+	}
+
+	cctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rec := httptest.NewRecorder()
+	ctx := &Context{
+		Req:            httptest.NewRequest(http.MethodGet, "/big.bin", nil).WithContext(cctx),
+		ResponseWriter: cancelWriter{rec, cancel},
+	}
+	ctx.File(fp)
+
+	if n := rec.Body.Len(); n == 0 || n >= size {
+		t.Fatalf("expected a partial copy, got %d bytes", n)
+	}
+
+	if tracker == nil || !tracker.closed {
+		t.Fatal("expected the file to be closed")
+	}
+}
+
+func TestChain(t *testing.T) {
+	mw := func(s string) Handler {
+		return func(ctx *Context) Response {
+			ctx.Set("order", ctx.Get("order").(string)+s)
+			if ctx.Query("break") == s {
+				return RespForbidden
+			}
+			return nil
+		}
+	}
+
+	base := Chain{mw("a"), mw("b")}
+	ext := base.Append(mw("c"))
+	_ = base.Append(mw("x")) // must not affect ext
+
+	var buf bytes.Buffer
+	srv := New(SetErrLogger(log.New(&buf, "", 0)))
+	srv.Use(func(ctx *Context) Response {
+		ctx.Set("order", "")
+		return nil
+	})
+	srv.GET("/", ext.Then(func(ctx *Context) Response {
+		return NewJSONResponse(ctx.Get("order"))
+	}))
+
+	// middlewares that call ctx.Next inside the chain must wrap the handler
+	srv.GET("/timeout", Chain{Timeout(time.Second)}.Then(func(ctx *Context) Response {
+		return NewJSONResponse("t")
+	}))
+	srv.GET("/log", Chain{LogRequests(false)}.Then(func(ctx *Context) Response {
+		return NewJSONErrorResponse(http.StatusTeapot)
+	}), func(ctx *Context) Response {
+		t.Error("the route's chain should've stopped")
+		return nil
+	})
+
+	for path, exp := range map[string]struct {
+		code int
+		body string
+	}{
+		"/":         {http.StatusOK, "abc"},
+		"/?break=b": {http.StatusForbidden, ""},
+		"/timeout":  {http.StatusOK, "t"},
+		"/log":      {http.StatusTeapot, ""},
+	} {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		var data string
+		r, _ := ReadJSONResponse(ioutil.NopCloser(w.Body), &data)
+		if w.Code != exp.code || r == nil || data != exp.body {
+			t.Fatalf("%s: unexpected response (%d): %q", path, w.Code, data)
+		}
+	}
+
+	if out := buf.String(); !strings.Contains(out, "[418] GET /log") {
+		t.Fatalf("unexpected log: %q", out)
+	}
+}
+
+func TestBaseURL(t *testing.T) {
+	srv := New(SetErrLogger(nil), TrustedProxies("10.0.0.0/8", "::1"))
+
+	for _, tc := range []struct {
+		remote, proto, host string
+		tls                 bool
+		exp                 string
+	}{
+		{"1.2.3.4:1234", "", "", false, "http://example.com/a?b=1"},
+		{"1.2.3.4:1234", "https", "evil.com", false, "http://example.com/a?b=1"},
+		{"1.2.3.4:1234", "", "", true, "https://example.com/a?b=1"},
+		{"10.1.2.3:1234", "https, http", "api.example.com", false, "https://api.example.com/a?b=1"},
+		{"[::1]:1234", "HTTPS", "", false, "https://example.com/a?b=1"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		req.RemoteAddr = tc.remote
+		if tc.proto != "" {
+			req.Header.Set("X-Forwarded-Proto", tc.proto)
+		}
+		if tc.host != "" {
+			req.Header.Set("X-Forwarded-Host", tc.host)
+		}
+		if !tc.tls {
+			req.TLS = nil
+		} else {
+			req.TLS = &tls.ConnectionState{}
+		}
+
+		ctx := &Context{Req: req, s: srv}
+		if u := ctx.AbsoluteURL("a?b=1"); u != tc.exp {
+			t.Fatalf("%+v: expected %s, got %s", tc, tc.exp, u)
+		}
+	}
+}
+
+func TestPagination(t *testing.T) {
+	defaults := Pagination{Limit: 10, MaxLimit: 50, Sort: "id"}
+	tests := []struct {
+		qs     string
+		exp    Pagination
+		errors int
+	}{
+		{"", Pagination{Page: 1, Limit: 10, Sort: "id"}, 0},
+		{"page=3&limit=20&sort=-name", Pagination{Page: 3, Limit: 20, Offset: 40, Sort: "-name"}, 0},
+		{"limit=500", Pagination{Page: 1, Limit: 50}, 0},
+		{"offset=25&limit=10", Pagination{Page: 3, Limit: 10, Offset: 25}, 0},
+		{"page=0&limit=x&offset=-1", Pagination{}, 3},
+	}
+
+	for _, tc := range tests {
+		ctx := &Context{Req: httptest.NewRequest(http.MethodGet, "/?"+tc.qs, nil)}
+		p, err := ctx.Pagination(defaults)
+		if tc.errors > 0 {
+			me, ok := err.(MultiError)
+			if !ok || len(me) != tc.errors {
+				t.Fatalf("%s: expected %d errors, got %v", tc.qs, tc.errors, err)
+			}
+			if e, ok := me[0].(*Error); !ok || e.Field != "page" {
+				t.Fatalf("%s: unexpected error: %v", tc.qs, me[0])
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%s: %v", tc.qs, err)
+		}
+
+		if tc.exp.Sort == "" {
+			tc.exp.Sort = "id"
+		}
+		tc.exp.MaxLimit = defaults.MaxLimit
+		if p != tc.exp {
+			t.Fatalf("%s: expected %+v, got %+v", tc.qs, tc.exp, p)
+		}
+	}
+}
+
+func TestResponseTap(t *testing.T) {
+	type tapped struct {
+		path   string
+		status int
+		body   string
+	}
+
+	var taps []tapped
+	srv := New(SetErrLogger(nil), ResponseTap(func(req *http.Request, status int, body []byte) {
+		taps = append(taps, tapped{req.URL.Path, status, string(body)})
+	}, 8))
+
+	srv.GET("/ok", func(ctx *Context) Response {
+		return PlainResponse("", "0123456789")
+	})
+
+	srv.GET("/events", func(ctx *Context) Response {
+		ctx.SetContentType("text/event-stream")
+		ctx.Write([]byte("data: 1\n\n"))
+		return Break
+	})
+
+	for _, p := range []string{"/ok", "/events", "/404"} {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, p, nil))
+		if p == "/ok" && w.Body.String() != "0123456789" {
+			t.Fatalf("the tap modified the response: %q", w.Body.String())
+		}
+	}
+
+	if len(taps) != 2 {
+		t.Fatalf("unexpected taps: %+v", taps)
+	}
+
+	if exp := (tapped{"/ok", http.StatusOK, "01234567"}); taps[0] != exp {
+		t.Fatalf("expected %+v, got %+v", exp, taps[0])
+	}
+
+	if taps[1].path != "/404" || taps[1].status != http.StatusNotFound {
+		t.Fatalf("unexpected tap: %+v", taps[1])
+	}
+}
+
+func TestBindHeader(t *testing.T) {
+	type config struct {
+		Region  string   `header:"X-Region"`
+		Retries int      `header:"X-Retries"`
+		Debug   *bool    `header:"x-debug"`
+		Tags    []string `header:"X-Tag"`
+		Ignored string
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Region", "us-east")
+	req.Header.Set("X-Retries", "3")
+	req.Header.Set("X-Debug", "true")
+	req.Header.Add("X-Tag", "a")
+	req.Header.Add("X-Tag", "b")
+	req.Header.Set("Ignored", "x")
+
+	var c config
+	if err := (&Context{Req: req}).BindHeader(&c); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Region != "us-east" || c.Retries != 3 || c.Debug == nil || !*c.Debug || len(c.Tags) != 2 || c.Ignored != "" {
+		t.Fatalf("unexpected value: %+v", c)
+	}
+
+	req.Header.Set("X-Retries", "x")
+	req.Header.Set("X-Debug", "maybe")
+	err := (&Context{Req: req}).BindHeader(&config{})
+	if me, ok := err.(MultiError); !ok || len(me) != 2 || me[0].(*Error).Field != "X-Retries" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestDebugRoutesHandler(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	mw := func(ctx *Context) Response { return nil }
+	h := func(ctx *Context) Response { return RespOK }
+	srv.Use(mw)
+
+	api := srv.Group("api", "/api", mw)
+	api.GET("/users/:id", mw, h)
+	api.GET("/_debug/routes", srv.DebugRoutesHandler())
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/_debug/routes", nil))
+
+	var routes []RouteInfo
+	if _, err := ReadJSONResponse(ioutil.NopCloser(w.Body), &routes); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := RouteInfo{Group: "api", Method: "GET", Pattern: "/api/users/:id", Params: []string{":id"}, Middlewares: 2, Handlers: 2}
+	if len(routes) != 2 || !reflect.DeepEqual(routes[1], exp) {
+		t.Fatalf("unexpected routes: %+v", routes)
+	}
+
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/_debug/routes?format=html", nil))
+	if ct := w.Header().Get("Content-Type"); ct != MimeHTML || !strings.Contains(w.Body.String(), "<td>/api/users/:id</td>") {
+		t.Fatalf("unexpected response: %s %s", ct, w.Body.String())
+	}
+}
+
+func TestPanicResponse(t *testing.T) {
+	srv := New(SetErrLogger(nil), PanicResponse(PanicResponseWithRequestInfo))
+	srv.Use(func(ctx *Context) Response {
+		ctx.Set(RequestIDContextKey, "rid-1")
+		return nil
+	})
+	srv.POST("/panic/:id", func(ctx *Context) Response {
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/panic/1", nil))
+
+	var data M
+	r, _ := ReadJSONResponse(ioutil.NopCloser(w.Body), &data)
+	if w.Code != http.StatusInternalServerError || r == nil || len(r.Errors) != 1 || r.Errors[0].Message != "PANIC (string): boom" {
+		t.Fatalf("unexpected response: %d %+v", w.Code, r)
+	}
+
+	if exp := (M{"requestID": "rid-1", "method": "POST", "path": "/panic/1"}); !reflect.DeepEqual(data, exp) {
+		t.Fatalf("expected %v, got %v", exp, data)
+	}
+}
+
+type pushRecorder struct {
+	*httptest.ResponseRecorder
+	pushed []string
+}
+
+func (p *pushRecorder) Push(target string, opts *http.PushOptions) error {
+	p.pushed = append(p.pushed, target)
+	return nil
+}
+
+func TestPush(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.Use(Gzip(6))
+	srv.GET("/", func(ctx *Context) Response {
+		if err := ctx.Push("/app.js", nil); err != nil {
+			return NewJSONErrorResponse(http.StatusInternalServerError, err)
+		}
+		return RespOK
+	})
+
+	w := &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK || len(w.pushed) != 1 || w.pushed[0] != "/app.js" {
+		t.Fatalf("unexpected push: %d %v", w.Code, w.pushed)
+	}
+
+	ctx := &Context{ResponseWriter: httptest.NewRecorder()}
+	if err := ctx.Push("/app.js", nil); err != ErrPushNotSupported {
+		t.Fatalf("expected ErrPushNotSupported, got %v", err)
+	}
+}
+
+type chanWriter chan string
+
+func (w chanWriter) Write(p []byte) (int, error) {
+	w <- string(p)
+	return len(p), nil
+}
+
+func TestCtxGo(t *testing.T) {
+	logs := make(chanWriter, 1)
+	srv := New(SetErrLogger(log.New(logs, "", 0)))
+
+	ids := make(chan string, 1)
+	srv.GET("/", func(ctx *Context) Response {
+		ctx.Set(RequestIDContextKey, "rid-1")
+		ctx.Go(func(c context.Context) {
+			ids <- RequestIDFromContext(c)
+		})
+		ctx.Go(func(c context.Context) {
+			panic("boom")
+		})
+		return RespOK
+	})
+
+	srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if id := <-ids; id != "rid-1" {
+		t.Fatalf("expected rid-1, got %q", id)
+	}
+
+	if out := <-logs; !strings.Contains(out, "[reqID:rid-1] [GET /] PANIC in ctx.Go (string): boom") {
+		t.Fatalf("unexpected log: %s", out)
+	}
+}
+
+type failReader struct{ t *testing.T }
+
+func (r failReader) Read(p []byte) (int, error) {
+	r.t.Fatal("the body shouldn't be read")
+	return 0, io.EOF
+}
+
+func TestCheckContinue(t *testing.T) {
+	srv := New(SetErrLogger(nil), CheckContinue(func(req *http.Request) bool {
+		return req.ContentLength <= 1024
+	}))
+	srv.POST("/upload", func(ctx *Context) Response {
+		if !ctx.ExpectsContinue() {
+			return NewJSONErrorResponse(http.StatusBadRequest)
+		}
+		b, _ := io.ReadAll(ctx.Req.Body)
+		return NewJSONResponse(len(b))
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", failReader{t})
+	req.Header.Set("Expect", "100-continue")
+	req.ContentLength = 1 << 20
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusExpectationFailed {
+		t.Fatalf("expected 417, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("hello"))
+	req.Header.Set("Expect", "100-continue")
+
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+}
+
+func TestJSONFiltered(t *testing.T) {
+	type user struct {
+		ID    int    `json:"id"`
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+
+	tests := []struct {
+		qs  string
+		v   interface{}
+		exp string
+	}{
+		{"", user{1, "a", "a@x"}, `{"id":1,"name":"a","email":"a@x"}`},
+		{"fields=id,name,nope", user{1, "a", "a@x"}, `{"id":1,"name":"a"}`},
+		{"fields=email", []user{{1, "a", "a@x"}, {2, "b", "b@x"}}, `[{"email":"a@x"},{"email":"b@x"}]`},
+		{"fields=id", "str", `"str"`},
+	}
+
+	for _, tc := range tests {
+		w := httptest.NewRecorder()
+		ctx := &Context{Req: httptest.NewRequest(http.MethodGet, "/?"+tc.qs, nil), ResponseWriter: w}
+		if err := ctx.JSONFiltered(http.StatusOK, tc.v); err != nil {
+			t.Fatal(err)
+		}
+
+		if out := strings.TrimSpace(w.Body.String()); out != tc.exp {
+			t.Fatalf("%s: expected %s, got %s", tc.qs, tc.exp, out)
+		}
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	s := New(SetErrLogger(nil))
+	s.GET("/ping", func(ctx *Context) Response {
+		return NewJSONResponse("pong")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.RunContext(ctx, "127.0.0.1:0") }()
+
+	for len(s.Addrs()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	resp, err := http.Get("http://" + s.Addrs()[0] + "/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	cancel()
+	if err := <-errCh; err != nil {
+		t.Fatalf("expected a clean shutdown, got %v", err)
+	}
+
+	if err := New(SetErrLogger(nil)).RunContext(context.Background(), "bad-addr"); err == nil {
+		t.Fatal("expected a listen error")
+	}
+}
+
+func TestStdContext(t *testing.T) {
+	type key struct{}
+
+	rctx, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "req"))
+	ctx := &Context{Req: httptest.NewRequest(http.MethodGet, "/", nil).WithContext(rctx), data: M{}}
+	ctx.Set("user", "u1")
+
+	var c context.Context = ctx.StdContext()
+	ctx.Set("late", true)
+
+	if c.Value("user") != "u1" || c.Value(key{}) != "req" || c.Value("late") != nil {
+		t.Fatalf("unexpected values: %v %v %v", c.Value("user"), c.Value(key{}), c.Value("late"))
+	}
+
+	cancel()
+	select {
+	case <-c.Done():
+	default:
+		t.Fatal("expected the context to be canceled")
+	}
+}
+
+func TestShutdownGracePeriod(t *testing.T) {
+	// the grace period is used as the deadline when it's shorter than the timeout or no timeout is passed
+	for _, timeout := range []time.Duration{0, 10 * time.Second} {
+		s := New(SetErrLogger(nil), ShutdownGracePeriod(50*time.Millisecond))
+		started, done := make(chan struct{}), make(chan struct{})
+		s.GET("/poll", func(ctx *Context) Response {
+			ctx.OnResponse(func(int, int) { close(done) })
+			close(started)
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Req.Context().Done():
+			}
+			return RespOK
+		})
+
+		errCh := make(chan error, 1)
+		go func() { errCh <- s.Run("127.0.0.1:0") }()
+		for len(s.Addrs()) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		go http.Get("http://" + s.Addrs()[0] + "/poll")
+		<-started
+
+		start := time.Now()
+		if err := s.Shutdown(timeout); err != ErrForcedShutdown {
+			t.Fatalf("%v: expected ErrForcedShutdown, got %v", timeout, err)
+		}
+
+		if d := time.Since(start); d > 500*time.Millisecond {
+			t.Fatalf("%v: shutdown took too long: %v", timeout, d)
+		}
+
+		<-errCh
+		<-done
+	}
+}
+
+func TestHTMLErrors(t *testing.T) {
+	srv := New(SetErrLogger(nil), HTMLErrors(nil))
+	srv.GET("/", func(ctx *Context) Response {
+		return NewJSONErrorResponse(http.StatusBadRequest, &Error{Field: "id", Message: "<invalid>"})
+	})
+
+	for accept, html := range map[string]bool{
+		"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8": true,
+		"application/json":                      false,
+		"application/json, text/html;q=0.5":     false,
+		"":                                      false,
+		"text/html;q=0.9, application/json;q=1": false,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%q: unexpected status %d", accept, w.Code)
+		}
+
+		if ct := w.Header().Get("Content-Type"); (ct == MimeHTML) != html {
+			t.Fatalf("%q: unexpected content-type %s", accept, ct)
+		}
+
+		if html && !strings.Contains(w.Body.String(), "<li><b>id</b>: &lt;invalid&gt;</li>") {
+			t.Fatalf("%q: unexpected body: %s", accept, w.Body.String())
+		}
+	}
+}
+
+func TestAutoOptions(t *testing.T) {
+	srv := New(SetErrLogger(nil), AutoOptions(true))
+	h := func(ctx *Context) Response { return RespOK }
+	srv.GET("/users/:id", h)
+	srv.DELETE("/users/:id", h)
+	srv.GET("/cors", h)
+	srv.AddRoute(http.MethodOptions, "/cors", func(ctx *Context) Response {
+		return PlainResponse(MimePlain, "custom")
+	})
+
+	do := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, path, nil))
+		return w
+	}
+
+	if w := do("/users/1"); w.Code != http.StatusNoContent || w.Header().Get("Allow") != "GET, HEAD, DELETE, OPTIONS" {
+		t.Fatalf("unexpected response: %d %v", w.Code, w.Header())
+	}
+
+	if w := do("/cors"); w.Code != http.StatusOK || w.Body.String() != "custom" {
+		t.Fatalf("unexpected response: %d %s", w.Code, w.Body.String())
+	}
+
+	if w := do("/nope"); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestJSONResponseMeta(t *testing.T) {
+	type meta struct {
+		Total int    `json:"total"`
+		Next  string `json:"next"`
+	}
+
+	srv := New(SetErrLogger(nil))
+	srv.GET("/list", func(ctx *Context) Response {
+		return NewJSONResponseWithMeta([]int{1, 2}, meta{Total: 10, Next: "abc"})
+	})
+	srv.GET("/plain", func(ctx *Context) Response {
+		return NewJSONResponse(1)
+	})
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/list", nil))
+
+	var (
+		data []int
+		m    meta
+	)
+	if _, err := ReadJSONResponseWithMeta(ioutil.NopCloser(w.Body), &data, &m); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(data) != 2 || m.Total != 10 || m.Next != "abc" {
+		t.Fatalf("unexpected response: %v %+v", data, m)
+	}
+
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/plain", nil))
+	if strings.Contains(w.Body.String(), "meta") {
+		t.Fatalf("unexpected meta: %s", w.Body.String())
+	}
+
+	srv = New(SetErrLogger(nil), JSONEnvelope(func(r *JSONResponse) interface{} {
+		return M{"result": r.Data, "page": r.Meta}
+	}))
+	srv.GET("/list", func(ctx *Context) Response {
+		return NewJSONResponseWithMeta([]int{1, 2}, meta{Total: 10, Next: "abc"})
+	})
+
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/list", nil))
+	if b := strings.TrimSpace(w.Body.String()); b != `{"page":{"total":10,"next":"abc"},"result":[1,2]}` {
+		t.Fatalf("unexpected envelope: %s", b)
+	}
+}
+
+func TestBindJSONOptional(t *testing.T) {
+	bind := func(body string, out *M) (bool, error) {
+		ctx := &Context{Req: httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(body))}
+		return ctx.BindJSONOptional(out)
+	}
+
+	var m M
+	if present, err := bind("", &m); present || err != nil || m != nil {
+		t.Fatalf("unexpected result: %v %v %v", present, err, m)
+	}
+
+	if present, err := bind(`{"a": 1}`, &m); !present || err != nil || m["a"] != 1.0 {
+		t.Fatalf("unexpected result: %v %v %v", present, err, m)
+	}
+
+	if present, err := bind(`{"a": `, &m); !present || !IsJSONSyntaxError(err) {
+		t.Fatalf("unexpected result: %v %v", present, err)
+	}
+}
+
+func TestConnState(t *testing.T) {
+	states := make(chan http.ConnState, 16)
+	s := New(SetErrLogger(nil), ConnState(func(c net.Conn, st http.ConnState) {
+		states <- st
+	}))
+	s.GET("/ping", func(ctx *Context) Response {
+		return NewJSONResponse("pong")
+	})
+
+	go s.Run("127.0.0.1:0")
+	defer s.Close()
+
+	for len(s.Addrs()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	resp, err := http.Get("http://" + s.Addrs()[0] + "/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	for _, exp := range []http.ConnState{http.StateNew, http.StateActive} {
+		if st := <-states; st != exp {
+			t.Fatalf("expected %v, got %v", exp, st)
+		}
+	}
+}
+
+func TestProblem(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.GET("/users/:id", func(ctx *Context) Response {
+		return NewProblemResponse(http.StatusNotFound, &Error{Field: "id", Message: "user not found"})
+	})
+	srv.GET("/custom", func(ctx *Context) Response {
+		ctx.Problem(0, ProblemDetails{Type: "https://example.com/probs/out-of-credit", Instance: ctx.Path()})
+		return nil
+	})
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+	var p ProblemDetails
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := ProblemDetails{
+		Title: "Not Found", Status: http.StatusNotFound, Detail: "user not found",
+		Errors: []*Error{{Field: "id", Message: "user not found"}},
+	}
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Type") != MimeProblemJSON || !reflect.DeepEqual(p, exp) {
+		t.Fatalf("unexpected response: %d %v %+v", w.Code, w.Header(), p)
+	}
+
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/custom", nil))
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), `"instance":"/custom"`) {
+		t.Fatalf("unexpected response: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestFallback(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.GET("/stats", Fallback(func(ctx *Context) Response {
+		panic("db is down")
+	}, func(ctx *Context, v interface{}) Response {
+		return NewJSONResponse("stale")
+	}))
+	srv.GET("/ok", Fallback(func(ctx *Context) Response {
+		return NewJSONResponse("fresh")
+	}, nil))
+
+	for path, exp := range map[string]string{"/stats": "stale", "/ok": "fresh"} {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"`+exp+`"`) {
+			t.Fatalf("%s: unexpected response: %d %s", path, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestQueryArrayMap(t *testing.T) {
+	ctx := &Context{Req: httptest.NewRequest(http.MethodGet, "/?tag=a&tag=b&f[name]=x&f[age]=1&f[]=y&fx[a]=z&f=w", nil)}
+
+	if v := ctx.QueryArray("tag"); !reflect.DeepEqual(v, []string{"a", "b"}) {
+		t.Fatalf("unexpected array: %v", v)
+	}
+
+	if v := ctx.QueryArray("nope"); v == nil || len(v) != 0 {
+		t.Fatalf("expected an empty array, got %#v", v)
+	}
+
+	if v := ctx.QueryMap("f"); !reflect.DeepEqual(v, map[string]string{"name": "x", "age": "1"}) {
+		t.Fatalf("unexpected map: %v", v)
+	}
+
+	if v := ctx.QueryMap("nope"); v == nil || len(v) != 0 {
+		t.Fatalf("expected an empty map, got %#v", v)
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	ctx := &Context{}
+	if r := ctx.ValidationError(NewErrorBuilder()); r != nil {
+		t.Fatalf("expected nil, got %v", r)
+	}
+
+	eb := NewErrorBuilder().Missing("name").Field("age", "must be positive")
+	r := ctx.ValidationError(eb).(*JSONResponse)
+	exp := []*Error{
+		{Message: `missing field "name"`, Field: "name", IsMissing: true},
+		{Message: "must be positive", Field: "age"},
+	}
+	if r.Code != http.StatusUnprocessableEntity || !reflect.DeepEqual(r.Errors, exp) {
+		t.Fatalf("unexpected response: %+v", r)
+	}
+
+	if me, ok := eb.Err().(MultiError); !ok || len(me) != 2 {
+		t.Fatalf("unexpected error: %v", eb.Err())
+	}
+
+	ctx.s = New(ValidationErrorCode(http.StatusBadRequest))
+	if r := ctx.ValidationError(eb).(*JSONResponse); r.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", r.Code)
+	}
+}
+
+func TestStaticFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":      {Data: []byte("<h1>home</h1>")},
+		"css/site.css":    {Data: []byte("body{}")},
+		"docs/index.html": {Data: []byte("docs")},
+	}
+
+	s := New(SetErrLogger(nil))
+	s.GET("/s/*fp", StaticFS(fsys, "fp"))
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		path, body, ct string
+		code           int
+	}{
+		{"/s/", "<h1>home</h1>", "text/html; charset=utf-8", 200},
+		{"/s/css/site.css", "body{}", "text/css; charset=utf-8", 200},
+		{"/s/docs", "docs", "text/html; charset=utf-8", 200},
+		{"/s/../../etc/passwd", "", "", 404},
+		{"/s/nope.js", "", "", 404},
+	} {
+		res, err := http.Get(srv.URL + tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+
+		if res.StatusCode != tc.code {
+			t.Fatalf("%s: expected %d, got %d", tc.path, tc.code, res.StatusCode)
+		}
+
+		if tc.code != 200 {
+			continue
+		}
+
+		if string(b) != tc.body || res.Header.Get("Content-Type") != tc.ct {
+			t.Fatalf("%s: unexpected response %q (%s)", tc.path, b, res.Header.Get("Content-Type"))
+		}
+	}
+}
+
+func TestAbortWithStatus(t *testing.T) {
+	var afterCalled bool
+	s := New(SetErrLogger(nil))
+	s.GET("/abort", func(ctx *Context) Response {
+		return ctx.AbortWithStatus(http.StatusForbidden)
+	}, func(ctx *Context) Response {
+		afterCalled = true
+		return RespOK
+	})
+	s.GET("/done", func(ctx *Context) Response {
+		ctx.WriteHeader(http.StatusAccepted)
+		ctx.Write([]byte("ok"))
+		return ctx.AbortWithStatus(http.StatusForbidden)
+	})
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/abort", nil))
+	if w.Code != http.StatusForbidden || w.Body.Len() != 0 {
+		t.Fatalf("unexpected response: %d %q", w.Code, w.Body.String())
+	}
+	if afterCalled {
+		t.Fatal("the chain didn't stop")
+	}
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/done", nil))
+	if w.Code != http.StatusAccepted || w.Body.String() != "ok" {
+		t.Fatalf("unexpected response: %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	for _, tc := range []struct {
+		cc  CacheControl
+		exp string
+	}{
+		{CacheControl{}, ""},
+		{CacheControl{NoStore: true, Public: true, MaxAge: time.Hour}, "no-store"},
+		{CacheControl{Public: true, MaxAge: time.Hour}, "public, max-age=3600"},
+		{CacheControl{Public: true, Private: true, NoCache: true}, "private, no-cache"},
+		{CacheControl{
+			MaxAge: 90 * time.Second, MustRevalidate: true, StaleWhileRevalidate: 1500 * time.Millisecond,
+		}, "max-age=90, must-revalidate, stale-while-revalidate=1"},
+	} {
+		if v := tc.cc.String(); v != tc.exp {
+			t.Fatalf("%+v: expected %q, got %q", tc.cc, tc.exp, v)
+		}
+	}
+
+	ctx := &Context{ResponseWriter: httptest.NewRecorder()}
+	ctx.SetCacheControl(CacheControl{Private: true, MaxAge: time.Minute})
+	if v := ctx.Header().Get("Cache-Control"); v != "private, max-age=60" {
+		t.Fatalf("unexpected header: %q", v)
+	}
+
+	ctx.NoStore()
+	if v := ctx.Header().Get("Cache-Control"); v != "no-store" {
+		t.Fatalf("unexpected header: %q", v)
+	}
+}
+
+func TestPropagateContextValues(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		s := New(SetErrLogger(nil), PropagateContextValues(enabled))
+		s.GET("/", func(ctx *Context) Response {
+			ctx.Set("user", "bob")
+			return nil
+		}, func(ctx *Context) Response {
+			v, _ := ctx.Req.Context().Value(ContextKey("user")).(string)
+			return NewJSONResponse(v)
+		})
+
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		var v string
+		if _, err := ReadJSONResponse(ioutil.NopCloser(w.Body), &v); err != nil {
+			t.Fatal(err)
+		}
+
+		if exp := map[bool]string{true: "bob"}[enabled]; v != exp {
+			t.Fatalf("enabled=%v: expected %q, got %q", enabled, exp, v)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), ContextKey("lib"), 42))
+	ctx := &Context{Req: req, data: M{}}
+	if v := ctx.Get("lib"); v != 42 {
+		t.Fatalf("expected the request context's value, got %v", v)
+	}
+
+	ctx.Set("lib", 1)
+	if v := ctx.Get("lib"); v != 1 {
+		t.Fatalf("expected ctx.Set to take precedence, got %v", v)
+	}
+}
+
+func TestJSONResponseBuilder(t *testing.T) {
+	s := New(SetErrLogger(nil))
+	s.POST("/build", func(ctx *Context) Response {
+		return ctx.JSONResponse().Status(http.StatusCreated).Data("x").Header("Location", "/x/1").Build()
+	})
+	s.GET("/write", func(ctx *Context) Response {
+		if err := ctx.JSONResponse().Errors("bad", errors.New("worse")).Write(); err != nil {
+			t.Error(err)
+		}
+		return nil
+	})
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("POST", "/build", nil))
+
+	var v string
+	r, err := ReadJSONResponse(ioutil.NopCloser(w.Body), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusCreated || r.Code != http.StatusCreated || v != "x" || w.Header().Get("Location") != "/x/1" {
+		t.Fatalf("unexpected response: %d %+v %q %v", w.Code, r, v, w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/write", nil))
+	if r, err = ReadJSONResponse(ioutil.NopCloser(w.Body), nil); err == nil {
+		t.Fatal("expected an error")
+	}
+	if w.Code != http.StatusBadRequest || len(r.Errors) != 2 || r.Errors[1].Message != "worse" {
+		t.Fatalf("unexpected response: %d %+v", w.Code, r)
+	}
+}
+
+func TestSetHeaders(t *testing.T) {
+	w := httptest.NewRecorder()
+	ctx := &Context{ResponseWriter: w}
+	ctx.Header().Set("X-A", "old")
+
+	ctx.SetHeaders(map[string]string{"X-A": "a", "x-b": "b"})
+	ctx.AddHeader("Link", `</?page=2>; rel="next"`)
+	ctx.AddHeader("Link", `</?page=9>; rel="last"`)
+
+	h := w.Header()
+	if h.Get("X-A") != "a" || h.Get("X-B") != "b" || len(h.Values("Link")) != 2 {
+		t.Fatalf("unexpected headers: %v", h)
+	}
+}
+
+func TestReadJSONResponseLimit(t *testing.T) {
+	body := `{"code":200,"success":true,"data":"` + strings.Repeat("x", 100) + `"}`
+
+	var v string
+	if _, err := ReadJSONResponseLimit(ioutil.NopCloser(strings.NewReader(body)), &v, 64); err != ErrResponseTooLarge {
+		t.Fatalf("expected ErrResponseTooLarge, got %v", err)
+	}
+
+	if _, err := ReadJSONResponseLimit(ioutil.NopCloser(strings.NewReader(body)), &v, int64(len(body))); err != nil || len(v) != 100 {
+		t.Fatalf("unexpected result: %v %q", err, v)
+	}
+}
+
+type notFoundPanic string
+
+func TestRegisterPanicMapper(t *testing.T) {
+	RegisterPanicMapper(func(v interface{}) (int, Response, bool) {
+		if nf, ok := v.(notFoundPanic); ok {
+			return http.StatusNotFound, nil, nf != ""
+		}
+		return 0, nil, false
+	})
+
+	var buf bytes.Buffer
+	s := New(SetErrLogger(log.New(&buf, "", 0)))
+	s.GET("/nf", func(ctx *Context) Response {
+		panic(notFoundPanic("user"))
+	})
+	s.GET("/unclaimed", func(ctx *Context) Response {
+		panic(notFoundPanic(""))
+	})
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/nf", nil))
+	if w.Code != http.StatusNotFound || buf.Len() != 0 {
+		t.Fatalf("unexpected response: %d, log: %s", w.Code, buf.String())
+	}
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/unclaimed", nil))
+	if w.Code != http.StatusInternalServerError || !strings.Contains(buf.String(), "PANIC") {
+		t.Fatalf("unexpected response: %d, log: %s", w.Code, buf.String())
+	}
+}
+
+func TestAccepts(t *testing.T) {
+	for _, tc := range []struct {
+		accept string
+		mimes  []string
+		exp    string
+	}{
+		{"", []string{"application/json", "text/html"}, "application/json"},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", []string{MimeJSON, MimeHTML}, MimeHTML},
+		{"application/json;q=0.5, text/*", []string{"application/json", "text/plain"}, "text/plain"},
+		{"text/*;q=0.5, text/csv", []string{"text/plain", "text/csv"}, "text/csv"},
+		{"*/*", []string{"application/json", "text/html"}, "application/json"},
+		{"image/png", []string{"application/json"}, ""},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", tc.accept)
+		ctx := &Context{Req: req}
+		if v := ctx.Accepts(tc.mimes...); v != tc.exp {
+			t.Fatalf("%q: expected %q, got %q", tc.accept, tc.exp, v)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "text/html")
+	ctx := &Context{Req: req}
+	if !ctx.AcceptsHTML() || ctx.AcceptsJSON() {
+		t.Fatal("expected html only")
+	}
+}
+
+type protoMsg string
+
+func TestProto(t *testing.T) {
+	ProtoMarshal = func(v interface{}) ([]byte, error) {
+		if m, ok := v.(protoMsg); ok {
+			return []byte("proto:" + m), nil
+		}
+		return nil, errors.New("not a proto message")
+	}
+	t.Cleanup(func() { ProtoMarshal = nil })
+
+	srv := New(SetErrLogger(nil))
+	srv.GET("/msg", func(ctx *Context) Response {
+		return NewProtoResponse(protoMsg("x"))
+	})
+	srv.GET("/json", func(ctx *Context) Response {
+		return NewJSONResponse(protoMsg("y"))
+	})
+	srv.GET("/other", func(ctx *Context) Response {
+		return NewJSONResponse("z")
+	})
+
+	for path, exp := range map[string]string{
+		"/msg":   "proto:x",
+		"/json":  "proto:y",
+		"/other": `{"data":"z","code":200,"success":true}`,
+	} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", MimeProtobuf)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+
+		if body := strings.TrimSpace(w.Body.String()); body != exp {
+			t.Fatalf("%s: expected %q, got %q", path, exp, body)
+		}
+
+		if ct := w.Header().Get("Content-Type"); path != "/other" && (ct != MimeProtobuf || w.Header().Get("Content-Length") != "7") {
+			t.Fatalf("%s: unexpected headers: %v", path, w.Header())
+		}
+	}
+
+	for accept, proto := range map[string]bool{
+		"application/protobuf":                           true,
+		"application/x-protobuf;q=0":                     false,
+		"application/json, application/x-protobuf;q=0.5": false,
+		"*/*": false,
+	} {
+		req := httptest.NewRequest("GET", "/json", nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+
+		if ct := w.Header().Get("Content-Type"); (ct == MimeProtobuf) != proto {
+			t.Fatalf("%q: unexpected content-type %s", accept, ct)
+		}
+	}
+
+	// the compressed size isn't known ahead of time
+	srv.GET("/gz", Gzip(6), func(ctx *Context) Response {
+		return NewProtoResponse(protoMsg("x"))
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if err != nil || !resp.Uncompressed || string(b) != "proto:x" {
+		t.Fatalf("unexpected gzip response (%v, %v): %q", err, resp.Uncompressed, b)
+	}
+}
+
+func TestSetTrailer(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.GET("/stream", func(ctx *Context) Response {
+		if err := ctx.SetTrailer("grpc-status", "2"); err != nil {
+			t.Error(err)
+		}
+		ctx.Write([]byte("data"))
+		ctx.SetTrailer("Grpc-Status", "0")
+		ctx.SetTrailer("X-Late", "yes")
+		return nil
+	})
+	srv.GET("/fixed", func(ctx *Context) Response {
+		ctx.Header().Set("Content-Length", "4")
+		if err := ctx.SetTrailer("X-Status", "0"); err != ErrTrailersNotSupported {
+			t.Errorf("expected ErrTrailersNotSupported, got %v", err)
+		}
+		ctx.Write([]byte("data"))
+		return nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	if string(b) != "data" || res.Header.Get("Grpc-Status") != "" {
+		t.Fatalf("unexpected response: %q %v", b, res.Header)
+	}
+
+	if res.Trailer.Get("Grpc-Status") != "0" || res.Trailer.Get("X-Late") != "yes" {
+		t.Fatalf("unexpected trailers: %v", res.Trailer)
+	}
+
+	if res, err = http.Get(ts.URL + "/fixed"); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+}
+
+func TestBindMultipartJSON(t *testing.T) {
+	newReq := func(meta string, withFile bool) *http.Request {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		if meta != "" {
+			mw.WriteField("meta", meta)
+		}
+		if withFile {
+			fw, _ := mw.CreateFormFile("file", "a.txt")
+			fw.Write([]byte("hello"))
+		}
+		mw.Close()
+
+		req := httptest.NewRequest("POST", "/", &buf)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		return req
+	}
+
+	type meta struct {
+		Title string `json:"title"`
+	}
+
+	var m meta
+	ctx := &Context{Req: newReq(`{"title":"x"}`, true)}
+	fh, err := ctx.BindMultipartJSON("meta", &m)
+	if err != nil || m.Title != "x" || fh.Filename != "a.txt" || fh.Size != 5 {
+		t.Fatalf("unexpected result: %v %+v %+v", err, m, fh)
+	}
+
+	ctx = &Context{Req: newReq("", true)}
+	if _, err = ctx.BindMultipartJSON("meta", &m); err == nil || !err.(*Error).IsMissing {
+		t.Fatalf("expected a missing error, got %v", err)
+	}
+
+	ctx = &Context{Req: newReq(`{"title":"x"}`, false)}
+	if _, err = ctx.BindMultipartJSON("meta", &m); err != http.ErrMissingFile {
+		t.Fatalf("expected http.ErrMissingFile, got %v", err)
+	}
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	for _, exempt := range []bool{false, true} {
+		s := New(SetErrLogger(nil), CaseInsensitive(true, exempt))
+		s.GET("/Users/:id", func(ctx *Context) Response {
+			return NewJSONResponse(ctx.Param("id"))
+		})
+		s.GET("/static/*fp", func(ctx *Context) Response {
+			return NewJSONResponse(ctx.Param("fp"))
+		})
+
+		for path, exp := range map[string]string{
+			"/users/AbC":        "AbC",
+			"/USERS/x":          "x",
+			"/static/Img/A.PNG": "Img/A.PNG",
+			"/Static/a.png":     map[bool]string{false: "a.png"}[exempt],
+		} {
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+
+			if exp == "" {
+				if w.Code != http.StatusNotFound {
+					t.Fatalf("%s (exempt=%v): expected 404, got %d", path, exempt, w.Code)
+				}
+				continue
+			}
+
+			var v string
+			if _, err := ReadJSONResponse(ioutil.NopCloser(w.Body), &v); err != nil || v != exp {
+				t.Fatalf("%s (exempt=%v): expected %q, got %q (%v)", path, exempt, exp, v, err)
+			}
+		}
+
+		if routes := s.Routes(); !strings.Contains(fmt.Sprint(routes), "/Users/:id") {
+			t.Fatalf("expected the original route, got %v", routes)
+		}
+	}
+}
+
+func TestSendFile(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "report.csv")
+	if err := ioutil.WriteFile(fp, []byte("a,b\n1,2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(SetErrLogger(nil))
+	s.GET("/view", func(ctx *Context) Response {
+		ctx.SendFile(fp, false)
+		return nil
+	})
+	s.GET("/download", func(ctx *Context) Response {
+		ctx.SendFile(fp, true)
+		return nil
+	})
+	s.GET("/missing", func(ctx *Context) Response {
+		ctx.SendFile(fp+".nope", true)
+		return nil
+	})
+
+	for path, cd := range map[string]string{
+		"/view":     "",
+		"/download": `attachment; filename=report.csv`,
+	} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Range", "bytes=0-2")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+
+		if w.Code != http.StatusPartialContent || w.Body.String() != "a,b" || w.Header().Get("Content-Disposition") != cd {
+			t.Fatalf("%s: unexpected response: %d %q %v", path, w.Code, w.Body.String(), w.Header())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/missing", nil))
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Disposition") != "" {
+		t.Fatalf("unexpected response: %d %v", w.Code, w.Header())
+	}
+}
+
+func TestDroppedResponse(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		var buf bytes.Buffer
+		s := New(SetErrLogger(log.New(&buf, "", 0)), StrictResponses(strict))
+		s.GET("/dropped", func(ctx *Context) Response {
+			ctx.JSON(http.StatusAccepted, false, "x")
+			return RespOK
+		})
+		s.POST("/bind", func(ctx *Context) Response {
+			var v struct{}
+			if r := ctx.MustBindJSON(&v); r != nil {
+				return r
+			}
+			return RespOK
+		})
+
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", "/dropped", nil))
+		if w.Code != http.StatusAccepted || strings.TrimSpace(w.Body.String()) != `"x"` {
+			t.Fatalf("unexpected response: %d %q", w.Code, w.Body.String())
+		}
+
+		out := buf.String()
+		if !strings.Contains(out, "*apiserv.JSONResponse returned after the response was written") {
+			t.Fatalf("expected a warning, got %q", out)
+		}
+
+		if hasPanic := strings.Contains(out, "PANIC"); hasPanic != strict {
+			t.Fatalf("strict=%v: unexpected log: %q", strict, out)
+		}
+
+		buf.Reset()
+		w = httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("POST", "/bind", strings.NewReader("{")))
+		if w.Code != http.StatusBadRequest || buf.Len() != 0 {
+			t.Fatalf("unexpected response: %d, log: %q", w.Code, buf.String())
+		}
+	}
+}
+
+func TestPassThroughResponses(t *testing.T) {
+	var buf bytes.Buffer
+	s := New(SetErrLogger(log.New(&buf, "", 0)), StrictResponses(true))
+	s.Use(func(ctx *Context) Response { return ctx.Next() })
+	s.GET("/accepted", func(ctx *Context) Response { return RespAccepted })
+	s.GET("/built", func(ctx *Context) Response {
+		return ctx.JSONResponse().Status(http.StatusTeapot).Header("X-Built", "1").Data("x").Build()
+	})
+
+	for path, code := range map[string]int{"/accepted": http.StatusAccepted, "/built": http.StatusTeapot} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != code || buf.Len() != 0 {
+			t.Fatalf("%s: unexpected response: %d, log: %q", path, w.Code, buf.String())
+		}
+	}
+}
+
+func TestBufferJSONResponses(t *testing.T) {
+	big := strings.Repeat("x", 8<<10) // bigger than the http server's chunking buffer
+
+	for _, buffered := range []bool{false, true} {
+		s := New(SetErrLogger(nil), BufferJSONResponses(buffered))
+		s.GET("/", func(ctx *Context) Response {
+			r := NewJSONResponse(big)
+			r.Indent = ctx.Query("indent") != ""
+			return r
+		})
+		s.GET("/gz", func(ctx *Context) Response {
+			ctx.EnableGzip(6)
+			return NewJSONResponse(big)
+		})
+
+		ts := httptest.NewServer(s)
+
+		for _, path := range []string{"/", "/?indent=1"} {
+			res, err := http.Get(ts.URL + path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var v string
+			if _, err = ReadJSONResponse(res.Body, &v); err != nil || v != big {
+				t.Fatalf("unexpected response: %v", err)
+			}
+
+			if (res.ContentLength > 0) != buffered {
+				t.Fatalf("%s (buffered=%v): unexpected Content-Length: %d", path, buffered, res.ContentLength)
+			}
+		}
+
+		req, _ := http.NewRequest("GET", ts.URL+"/gz", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.ContentLength != -1 {
+			t.Fatalf("expected compressed responses to be chunked, got %d", res.ContentLength)
+		}
+
+		ts.Close()
+	}
+}
+
+func TestMustBindJSON(t *testing.T) {
+	type req struct {
+		Name string `json:"name"`
+	}
+
+	s := New(SetErrLogger(nil))
+	s.POST("/", func(ctx *Context) Response {
+		var v req
+		if r := ctx.MustBindJSON(&v); r != nil {
+			if !ctx.Done() {
+				t.Error("MustBindJSON must write the response")
+			}
+			return r
+		}
+		return NewJSONResponse(v.Name)
+	})
+
+	for body, code := range map[string]int{`{"name":"bob"}`: http.StatusOK, `{"name":`: http.StatusBadRequest, ``: http.StatusBadRequest} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader(body)))
+		if w.Code != code {
+			t.Fatalf("%q: expected %d, got %d", body, code, w.Code)
+		}
+	}
+}
+
+func TestSetWriteDeadlineNotSupported(t *testing.T) {
+	ctx := &Context{ResponseWriter: struct{ http.ResponseWriter }{httptest.NewRecorder()}}
+	if err := ctx.SetWriteDeadline(time.Now().Add(time.Second)); !errors.Is(err, http.ErrNotSupported) {
+		t.Fatalf("expected http.ErrNotSupported, got %v", err)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	rec := httptest.NewRecorder()
+	ctx := &Context{ResponseWriter: rec}
+	if !ctx.CanFlush() {
+		t.Fatal("expected the recorder to support flushing")
+	}
+	ctx.Write([]byte("x"))
+	ctx.Flush()
+	if !rec.Flushed {
+		t.Fatal("expected the recorder to be flushed")
+	}
+
+	ctx = &Context{ResponseWriter: struct{ http.ResponseWriter }{httptest.NewRecorder()}}
+	if ctx.CanFlush() {
+		t.Fatal("didn't expect a wrapped writer to support flushing")
+	}
+	ctx.Flush() // no-op
+}
+
+func TestFail(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.GET("/users/:id", func(ctx *Context) Response {
+		return Fail(http.StatusNotFound, "user not found")
+	})
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+	r, err := ReadJSONResponse(ioutil.NopCloser(w.Body), nil)
+	if err == nil || w.Code != http.StatusNotFound || r.Success || len(r.Errors) != 1 || r.Errors[0].Message != "user not found" {
+		t.Fatalf("unexpected response (%d, %v): %+v", w.Code, err, r)
+	}
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+// +build !windows
+
+package apiserv
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunWithGracefulShutdown(t *testing.T) {
+	s := New(SetErrLogger(nil), SetShutdownSignals(syscall.SIGUSR1))
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.RunWithGracefulShutdown("127.0.0.1:0", time.Second) }()
+
+	for len(s.Addrs()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("server didn't shutdown")
+	}
+
+	if !s.Closed() {
+		t.Fatal("expected the server to be closed")
+	}
+}
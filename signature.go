@@ -0,0 +1,136 @@
+package apiserv
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureOptions controls the VerifySignature middleware.
+type SignatureOptions struct {
+	// Header is the request header holding the signature, defaults to X-Signature.
+	// The signature can be hex or base64 encoded.
+	Header string
+
+	// Prefix is stripped from the header's value if set, ex: "sha256=".
+	Prefix string
+
+	// Secret is the HMAC key, SecretFunc takes precedence if set, for example to look up a per-client key.
+	Secret     []byte
+	SecretFunc func(ctx *Context) ([]byte, error)
+
+	// Algorithm is one of sha1, sha256 or sha512, defaults to sha256.
+	Algorithm string
+
+	// TimestampHeader if set, is the request header holding the unix timestamp (in seconds) of the request,
+	// the signed payload becomes "timestamp.body" and if Tolerance > 0, requests older (or newer) than it are rejected.
+	TimestampHeader string
+	Tolerance       time.Duration
+}
+
+// VerifySignature is a middleware that verifies the HMAC signature of the request's body,
+// it returns a 401 error response if the signature is missing or doesn't match.
+// The body is buffered (see ctx.RawBody) so the handlers can still read it.
+// It panics if opts.Algorithm isn't supported or neither Secret nor SecretFunc are set,
+// requests are rejected if SecretFunc returns an empty key.
+func VerifySignature(opts SignatureOptions) Handler {
+	var hfn func() hash.Hash
+	switch strings.ToLower(opts.Algorithm) {
+	case "", "sha256":
+		hfn = sha256.New
+	case "sha1":
+		hfn = sha1.New
+	case "sha512":
+		hfn = sha512.New
+	default:
+		panic("apiserv: unsupported signature algorithm: " + opts.Algorithm)
+	}
+
+	if len(opts.Secret) == 0 && opts.SecretFunc == nil {
+		panic("apiserv: VerifySignature requires a Secret or a SecretFunc")
+	}
+
+	hdr := opts.Header
+	if hdr == "" {
+		hdr = "X-Signature"
+	}
+
+	unauthorized := func(msg string) Response {
+		return NewJSONErrorResponse(http.StatusUnauthorized, msg)
+	}
+
+	return func(ctx *Context) Response {
+		sig, ok := decodeSignature(strings.TrimPrefix(ctx.ReqHeader().Get(hdr), opts.Prefix))
+		if !ok {
+			return unauthorized("missing or invalid signature")
+		}
+
+		var ts string
+		if opts.TimestampHeader != "" {
+			ts = ctx.ReqHeader().Get(opts.TimestampHeader)
+			n, err := strconv.ParseInt(ts, 10, 64)
+			if err != nil {
+				return unauthorized("missing or invalid timestamp")
+			}
+
+			if d := time.Since(time.Unix(n, 0)); opts.Tolerance > 0 && (d > opts.Tolerance || d < -opts.Tolerance) {
+				return unauthorized("timestamp outside the tolerance window")
+			}
+		}
+
+		body, err := ctx.RawBody()
+		if err != nil {
+			if err == ErrBodyTooLarge {
+				return NewJSONErrorResponse(http.StatusRequestEntityTooLarge)
+			}
+			return NewJSONErrorResponse(http.StatusBadRequest, err)
+		}
+
+		secret := opts.Secret
+		if opts.SecretFunc != nil {
+			if secret, err = opts.SecretFunc(ctx); err != nil {
+				return unauthorized(err.Error())
+			}
+		}
+
+		if len(secret) == 0 { // an empty key would make anyone able to sign requests
+			return unauthorized("unknown signing key")
+		}
+
+		mac := hmac.New(hfn, secret)
+		if ts != "" {
+			mac.Write([]byte(ts + "."))
+		}
+		mac.Write(body)
+
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return unauthorized("signature mismatch")
+		}
+
+		return nil
+	}
+}
+
+func decodeSignature(s string) ([]byte, bool) {
+	if s == "" {
+		return nil, false
+	}
+
+	if b, err := hex.DecodeString(s); err == nil {
+		return b, true
+	}
+
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil {
+		return b, true
+	}
+
+	return nil, false
+}
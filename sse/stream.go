@@ -36,6 +36,9 @@ func NewStream(ctx *apiserv.Context, bufSize int) (lastEventID string, ss *Strea
 		return
 	}
 
+	// compression buffers the events until the stream is closed
+	ctx.DisableCompression()
+
 	h := ctx.Header()
 	h.Set("Content-Type", "text/event-stream")
 	h.Set("Cache-Control", "no-cache")
@@ -0,0 +1,90 @@
+package apiserv
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// DefaultResponseTapMaxBody is the max number of body bytes passed to a ResponseTapFunc if the limit isn't set.
+const DefaultResponseTapMaxBody = 64 << 10 // 64kb
+
+// ResponseTapFunc gets called after every response is written, see the ResponseTap option.
+// body is what got written to the connection (compressed if a compression middleware is used) capped at the configured size,
+// it must not be retained after the func returns.
+type ResponseTapFunc func(req *http.Request, status int, body []byte)
+
+// tapRW copies the status and up to max bytes of the body while passing everything through to the real writer.
+type tapRW struct {
+	http.ResponseWriter
+	buf    []byte
+	max    int
+	status int
+	skip   bool
+}
+
+func (t *tapRW) WriteHeader(code int) {
+	if t.status == 0 {
+		t.status = t.check(code)
+	}
+	t.ResponseWriter.WriteHeader(code)
+}
+
+func (t *tapRW) Write(p []byte) (int, error) {
+	if t.status == 0 {
+		t.status = t.check(http.StatusOK)
+	}
+
+	if !t.skip {
+		if n := t.max - len(t.buf); n > 0 {
+			if n > len(p) {
+				n = len(p)
+			}
+			t.buf = append(t.buf, p[:n]...)
+		}
+	}
+
+	return t.ResponseWriter.Write(p)
+}
+
+// check skips streaming responses since they may never end.
+func (t *tapRW) check(code int) int {
+	if isStreaming(t.Header()) {
+		t.skip = true
+	}
+	return code
+}
+
+// Unwrap returns the original ResponseWriter, used by http.ResponseController.
+func (t *tapRW) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+func (t *tapRW) Flush() {
+	if hf, ok := t.ResponseWriter.(http.Flusher); ok {
+		hf.Flush()
+	}
+}
+
+// Hijack allows websockets to work with the tap enabled, hijacked connections aren't tapped.
+func (t *tapRW) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := t.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	t.skip = true
+	return hj.Hijack()
+}
+
+func (t *tapRW) done(req *http.Request, fn ResponseTapFunc) {
+	if t.skip {
+		return
+	}
+
+	if t.status == 0 {
+		t.status = http.StatusOK
+	}
+
+	fn(req, t.status, t.buf)
+}
@@ -0,0 +1,53 @@
+package apiserv
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Timeout is a middleware that sets a d deadline on the request's context for the rest of the chain,
+// handlers should pass ctx.Req.Context() to their blocking calls and return once it's done.
+// If the deadline is exceeded, the handler's response is replaced with a 504 error and the timeout is logged (see ctx.TimedOut).
+// If the client disconnects first (context.Canceled), nothing is written or logged.
+func Timeout(d time.Duration) Handler {
+	return func(ctx *Context) Response {
+		c, cancel := context.WithTimeout(ctx.Req.Context(), d)
+		defer cancel()
+
+		ctx.Req = ctx.Req.WithContext(c)
+		ctx.timeout = c
+
+		if r := ctx.Next(); r == nil && !ctx.done && c.Err() != nil {
+			ctx.writeResponse(NewJSONErrorResponse(http.StatusGatewayTimeout))
+		}
+
+		return Break
+	}
+}
+
+// TimedOut returns true if the deadline set by the Timeout middleware was exceeded,
+// as opposed to the client disconnecting (see ctx.ClientGone).
+func (ctx *Context) TimedOut() bool {
+	return ctx.timeout != nil && errors.Is(ctx.timeout.Err(), context.DeadlineExceeded)
+}
+
+// writeResponse writes r, unless the Timeout middleware's deadline was exceeded, then a 504 error is written instead,
+// or the client is gone, then nothing is written.
+func (ctx *Context) writeResponse(r Response) {
+	if ctx.timeout != nil {
+		switch err := ctx.timeout.Err(); {
+		case errors.Is(err, context.Canceled):
+			ctx.done, ctx.clientGone = true, true
+			return
+		case errors.Is(err, context.DeadlineExceeded):
+			if ctx.s != nil {
+				ctx.s.Logf("%srequest timed out", ctx.logPrefix())
+			}
+			r = NewJSONErrorResponse(http.StatusGatewayTimeout)
+		}
+	}
+
+	r.WriteToCtx(ctx)
+}
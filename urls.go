@@ -0,0 +1,91 @@
+package apiserv
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrUnknownRoute is returned from Server.URL if there's no route with the specific name.
+	ErrUnknownRoute = errors.New("unknown route name")
+
+	// ErrDuplicateRoute is returned from AddNamedRoute if the name is already used by a different path.
+	ErrDuplicateRoute = errors.New("duplicate route name")
+)
+
+// checkRouteName returns ErrDuplicateRoute if name is already used by a different path.
+func (s *Server) checkRouteName(name, path string) error {
+	s.serversMux.Lock()
+	defer s.serversMux.Unlock()
+
+	if p, ok := s.namedRoutes[name]; ok && p != path {
+		return ErrDuplicateRoute
+	}
+	return nil
+}
+
+// nameRoute registers the path pattern for name, the same name can be used for different methods on the same path.
+func (s *Server) nameRoute(name, path string) error {
+	s.serversMux.Lock()
+	defer s.serversMux.Unlock()
+
+	if p, ok := s.namedRoutes[name]; ok && p != path {
+		return ErrDuplicateRoute
+	}
+
+	if s.namedRoutes == nil {
+		s.namedRoutes = map[string]string{}
+	}
+
+	s.namedRoutes[name] = path
+	return nil
+}
+
+// URL returns the path of the route named name (see AddNamedRoute) with its params filled from the passed key, value pairs,
+// values are escaped, and catch-all params can contain slashes, for example:
+//	srv.URL("user", "id", "42")
+// It returns ErrUnknownRoute for unknown names or an *Error with the Field set for missing params.
+func (s *Server) URL(name string, params ...string) (string, error) {
+	s.serversMux.Lock()
+	pattern, ok := s.namedRoutes[name]
+	s.serversMux.Unlock()
+
+	if !ok {
+		return "", ErrUnknownRoute
+	}
+
+	parts := strings.Split(pattern, "/")
+	for i, p := range parts {
+		if p == "" || (p[0] != ':' && p[0] != '*') {
+			continue
+		}
+
+		v, ok := urlParam(params, p[1:])
+		if !ok {
+			return "", missingParam(p[1:])
+		}
+
+		if p[0] == ':' {
+			parts[i] = url.PathEscape(v)
+			continue
+		}
+
+		segs := strings.Split(strings.TrimPrefix(v, "/"), "/")
+		for j, seg := range segs {
+			segs[j] = url.PathEscape(seg)
+		}
+		parts[i] = strings.Join(segs, "/")
+	}
+
+	return strings.Join(parts, "/"), nil
+}
+
+func urlParam(kvs []string, key string) (string, bool) {
+	for i := 0; i+1 < len(kvs); i += 2 {
+		if kvs[i] == key {
+			return kvs[i+1], true
+		}
+	}
+	return "", false
+}
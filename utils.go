@@ -1,9 +1,16 @@
 package apiserv
 
 import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -74,6 +81,79 @@ func StaticDirWithLimit(dir, paramName string, limit int) Handler {
 	}
 }
 
+// StaticFS returns a handler that serves files from fsys, for example embedded assets:
+//	//go:embed static
+//	var static embed.FS
+//	sub, _ := fs.Sub(static, "static")
+//	s.GET("/s/*fp", StaticFS(sub, "fp"))
+// Directories serve their index.html if it exists, missing files return RespNotFound.
+func StaticFS(fsys fs.FS, paramName string) Handler {
+	return func(ctx *Context) Response {
+		name := strings.TrimPrefix(path.Clean("/"+ctx.Param(paramName)), "/")
+		if name == "" {
+			name = "."
+		}
+
+		f, fi, err := openFSFile(fsys, name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrInvalid) {
+				return RespNotFound
+			}
+			return NewJSONErrorResponse(http.StatusInternalServerError, err)
+		}
+		defer f.Close()
+
+		rs, ok := f.(io.ReadSeeker)
+		if !ok {
+			b, err := io.ReadAll(f)
+			if err != nil {
+				return NewJSONErrorResponse(http.StatusInternalServerError, err)
+			}
+			rs = bytes.NewReader(b)
+		}
+
+		ctx.ServeReader(fi.Name(), fi.ModTime(), rs)
+		return nil
+	}
+}
+
+// openFSFile opens name from fsys, directories open their index.html.
+func openFSFile(fsys fs.FS, name string) (fs.File, fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, nil, fs.ErrInvalid
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	if !fi.IsDir() {
+		return f, fi, nil
+	}
+
+	f.Close()
+	if f, err = fsys.Open(path.Join(name, "index.html")); err != nil {
+		return nil, nil, err
+	}
+
+	if fi, err = f.Stat(); err != nil || fi.IsDir() {
+		f.Close()
+		if err == nil {
+			err = fs.ErrNotExist
+		}
+		return nil, nil, err
+	}
+
+	return f, fi, nil
+}
+
 type noListingDir string
 
 func (d noListingDir) Open(name string) (f http.File, err error) {
@@ -194,3 +274,42 @@ func (me MultiError) Error() string {
 
 	return "multiple errors returned:\n\t" + strings.Join(errs, "\n\t")
 }
+
+type qualityValue struct {
+	value string
+	q     float64
+}
+
+// parseQualityList parses headers like Accept and Accept-Language,
+// values are returned sorted by their quality, values with q=0 are dropped.
+func parseQualityList(h string) []qualityValue {
+	if h == "" {
+		return nil
+	}
+
+	parts := strings.Split(h, ",")
+	out := make([]qualityValue, 0, len(parts))
+	for _, p := range parts {
+		qv := qualityValue{q: 1}
+		if idx := strings.IndexByte(p, ';'); idx != -1 {
+			for _, param := range strings.Split(p[idx+1:], ";") {
+				param = strings.TrimSpace(param)
+				if strings.HasPrefix(param, "q=") {
+					if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+						qv.q = q
+					}
+				}
+			}
+			p = p[:idx]
+		}
+
+		if qv.value = strings.TrimSpace(p); qv.value == "" || qv.q <= 0 {
+			continue
+		}
+
+		out = append(out, qv)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].q > out[j].q })
+	return out
+}
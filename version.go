@@ -0,0 +1,127 @@
+package apiserv
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// APIVersionContextKey is the key used by the APIVersion middleware to store the request's api version.
+const APIVersionContextKey = "apiVersion"
+
+// VersionOptions controls how the APIVersion middleware resolves the request's version.
+// Versions are normalized by lowercasing them and trimming the "v" prefix, so "V2", "v2" and "2" are all "2".
+type VersionOptions struct {
+	// Header is the request header to check first, for example "X-API-Version".
+	Header string
+
+	// Vendor enables parsing the version from Accept vendor media types,
+	// for example "myapp" matches "application/vnd.myapp.v2+json".
+	Vendor string
+
+	// AcceptParam enables parsing the version from an Accept media-type parameter,
+	// for example "version" matches "application/json; version=2".
+	AcceptParam string
+
+	// Default is used when the request doesn't specify a version.
+	Default string
+
+	// Supported if not empty, requests with a version not in the list get a 400 error response.
+	Supported []string
+}
+
+// APIVersion is a middleware that resolves the request's api version and stores it in the context,
+// it can be retrieved with ctx.APIVersion().
+func APIVersion(opts VersionOptions) Handler {
+	def := normalizeVersion(opts.Default)
+	supported := make(map[string]bool, len(opts.Supported))
+	for _, v := range opts.Supported {
+		supported[normalizeVersion(v)] = true
+	}
+
+	return func(ctx *Context) Response {
+		v := requestVersion(ctx.Req, &opts)
+		if v == "" {
+			v = def
+		}
+
+		if len(supported) > 0 && !supported[v] {
+			return NewJSONErrorResponse(http.StatusBadRequest, "unsupported api version: "+v)
+		}
+
+		ctx.Set(APIVersionContextKey, v)
+		return nil
+	}
+}
+
+// APIVersion returns the version set by the APIVersion middleware or an empty string.
+func (ctx *Context) APIVersion() string {
+	v, _ := ctx.Get(APIVersionContextKey).(string)
+	return v
+}
+
+// VersionRouter returns a handler that dispatches to the handler matching ctx.APIVersion(), falling back to def.
+// If there's no matching handler and def is nil, it returns a 400 error response.
+// Example:
+//	srv.GET("/users/:id", VersionRouter(map[string]Handler{"1": getUserV1, "2": getUserV2}, getUserV2))
+func VersionRouter(handlers map[string]Handler, def Handler) Handler {
+	m := make(map[string]Handler, len(handlers))
+	for v, h := range handlers {
+		m[normalizeVersion(v)] = h
+	}
+
+	return func(ctx *Context) Response {
+		v := ctx.APIVersion()
+		if h := m[v]; h != nil {
+			return h(ctx)
+		}
+
+		if def != nil {
+			return def(ctx)
+		}
+
+		return NewJSONErrorResponse(http.StatusBadRequest, "unknown api version: "+v)
+	}
+}
+
+func requestVersion(req *http.Request, opts *VersionOptions) string {
+	if opts.Header != "" {
+		if v := req.Header.Get(opts.Header); v != "" {
+			return normalizeVersion(v)
+		}
+	}
+
+	if opts.Vendor == "" && opts.AcceptParam == "" {
+		return ""
+	}
+
+	prefix := "application/vnd." + strings.ToLower(opts.Vendor) + "."
+	for _, part := range strings.Split(req.Header.Get("Accept"), ",") {
+		mt, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+
+		if opts.AcceptParam != "" {
+			if v := params[strings.ToLower(opts.AcceptParam)]; v != "" {
+				return normalizeVersion(v)
+			}
+		}
+
+		if opts.Vendor != "" && strings.HasPrefix(mt, prefix) {
+			v := mt[len(prefix):]
+			if idx := strings.IndexByte(v, '+'); idx != -1 {
+				v = v[:idx]
+			}
+			if v != "" {
+				return normalizeVersion(v)
+			}
+		}
+	}
+
+	return ""
+}
+
+func normalizeVersion(v string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(v)), "v")
+}